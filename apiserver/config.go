@@ -17,6 +17,7 @@ import (
 	"github.com/maxliu9403/common/gormdb"
 	"github.com/maxliu9403/common/kafka"
 	"github.com/maxliu9403/common/logger"
+	"github.com/maxliu9403/common/middleware"
 	"github.com/maxliu9403/common/rediscache"
 	"github.com/maxliu9403/common/tracer"
 	"github.com/spf13/cobra"
@@ -32,14 +33,16 @@ const (
 )
 
 type APIConfig struct {
-	App         AppConfig                 `yaml:"app"`
-	Log         logger.Config             `yaml:"log"`
-	MySQL       gormdb.DBConfig           `yaml:"mysql"`
-	Redis       rediscache.Config         `yaml:"redis"`
-	Kafka       kafka.Config              `yaml:"kafka"`
-	Tracer      tracer.Config             `yaml:"tracer"`
-	RateLimiter ratelimiter.LimiterConfig `yaml:"ratelimiter"`
-	Etcd        etcd.Config               `yaml:"etcd"`
+	App          AppConfig                  `yaml:"app"`
+	Log          logger.Config              `yaml:"log"`
+	MySQL        gormdb.DBConfig            `yaml:"mysql"`
+	Redis        rediscache.Config          `yaml:"redis"`
+	Kafka        kafka.Config               `yaml:"kafka"`
+	Tracer       tracer.Config              `yaml:"tracer"`
+	RateLimiter  ratelimiter.LimiterConfig  `yaml:"ratelimiter"`
+	LoadShedding ratelimiter.AdaptiveConfig `yaml:"load_shedding"`
+	Etcd         etcd.Config                `yaml:"etcd"`
+	Admin        middleware.AccessConfig    `yaml:"admin"` // admin 服务的访问控制
 }
 
 type AppConfig struct {
@@ -8,12 +8,14 @@ package apiserver
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"net/http"
 
 	"github.com/maxliu9403/common/ginpprof"
 	"github.com/maxliu9403/common/logger"
 	"github.com/maxliu9403/common/middleware"
+	"github.com/maxliu9403/common/ratelimiter"
 	"github.com/maxliu9403/common/tracer"
 	"github.com/gin-gonic/gin"
 	"github.com/opentracing/opentracing-go"
@@ -54,7 +56,9 @@ func newServer(ctx context.Context, c APIConfig, options []ServerOption) (server
 	}
 
 	server.initGin()
-	server.initAdmin()
+	if err = server.initAdmin(); err != nil {
+		return
+	}
 
 	// tracer 初始化必须在其他组件之前
 	if c.Tracer.LocalAgentHostPort != "" {
@@ -82,11 +86,14 @@ func (s *Server) initGin() {
 	}
 
 	g := gin.New()
+	g.Use(middleware.AccessLog(middleware.AccessLogSkipPaths("/ping")), middleware.Recovery())
 	// 开启跨域
 	if s.conf.App.Cors == "1" {
-		g.Use(gin.Recovery(), middleware.GinFormatterLog(), middleware.Cors())
-	} else {
-		g.Use(gin.Recovery(), middleware.GinFormatterLog())
+		g.Use(middleware.Cors())
+	}
+	// 自适应限流，过载时丢弃请求而不是排队等待
+	if s.conf.LoadShedding.Enable {
+		g.Use(middleware.LoadShedding(ratelimiter.NewAdaptiveLimiter(s.conf.App.ServiceName, s.conf.LoadShedding)))
 	}
 
 	g.GET("/ping", func(c *gin.Context) {
@@ -137,17 +144,25 @@ func (s *Server) initGin() {
 	s.engine = g
 }
 
-func (s *Server) initAdmin() {
+func (s *Server) initAdmin() error {
 	gin.SetMode(gin.ReleaseMode)
 	gin.DisableConsoleColor()
 
+	access, err := middleware.AccessControl(s.conf.Admin)
+	if err != nil {
+		return fmt.Errorf("init admin access control failed: %s", err.Error())
+	}
+
 	g := gin.New()
-	g.Use(middleware.GinFormatterLog(), gin.Recovery())
+	g.Use(middleware.AccessLog(middleware.AccessLogSkipPaths("/metrics")), middleware.Recovery(), access)
 
 	ginpprof.Wrap(g)
 	logger.Wrap(g)
+	ratelimiter.Wrap(g)
 
 	s.adminEngine = g
+
+	return nil
 }
 
 func (s *Server) AddGinGroup(group string) *gin.RouterGroup {
@@ -190,11 +205,12 @@ func (s *Server) StartAdminOnly() {
 }
 
 func (s *Server) Stop() {
-	_ = s.logger.Sync()
-
 	if s.tracer != nil {
 		_ = s.traceIO.Close()
 	}
+
+	// 最后等待异步缓冲中的日志写出
+	_ = logger.Sync()
 }
 
 func handleError(err error) {
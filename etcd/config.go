@@ -42,7 +42,7 @@ func (c *Config) Init(ctx context.Context) error {
 		Password:    c.Password,
 		Context:     ctx,
 	}
-	etcdCli.etcdConfig.Logger = logger.Default().Desugar()
+	etcdCli.etcdConfig.Logger = logger.Named("etcd").Desugar()
 	if c.CAFilePath != "" && c.CertFilePath != "" && c.KeyFilePath != "" {
 		_tlsConfig, err := createTLS(c.CAFilePath, c.CertFilePath, c.KeyFilePath)
 		if err != nil {
@@ -15,12 +15,19 @@ type BasicQuery struct {
 	Limit      int               `json:"Limit"`      // 分页条数
 	Offset     int               `json:"Offset"`     // 分页偏移量
 	Query      string            `json:"Query"`      // 自定义查询语句；使用RSQL语法
+	Cursor     string            `json:"Cursor"`     // 游标分页，上次返回的 NextCursor 或 PrevCursor
+	CountMode  CountMode         `json:"CountMode"`  // 计数方式，默认精确计数
 }
 
 type GetListCrud interface {
 	GetList(q BasicQuery, model, list interface{}) (total int64, err error)
 }
 
+// GetPageCrud 游标分页，不属于 BasicCrud，通过 NewCRUD(conn).(GetPageCrud) 或 *CRUDImpl 使用
+type GetPageCrud interface {
+	GetPage(q BasicQuery, model, list interface{}) (page PageInfo, err error)
+}
+
 type GetByIDCrud interface {
 	GetByID(model interface{}, id int64) error
 }
@@ -41,6 +48,11 @@ type UpdateCrud interface {
 	UpdateWithMap(model interface{}, u map[string]interface{}) error
 }
 
+// UpdateModelCrud 保存整个模型，不属于 BasicCrud，通过 NewCRUD(conn).(UpdateModelCrud) 或 *CRUDImpl 使用
+type UpdateModelCrud interface {
+	UpdateModel(model interface{}) error
+}
+
 type DeleteCrud interface {
 	Delete(model interface{}, hardDelete bool) error
 }
@@ -0,0 +1,146 @@
+/*
+@Date: 2022/3/28 11:05
+@Author: max.liu
+@File : column
+*/
+
+package gormdb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+var ErrInvalidColumn = errors.New("invalid column")
+
+// queryTag 控制字段能否被 BasicQuery 引用：
+// query:"-" 禁止引用；模型中有字段标记 query:"allow" 时只允许引用这些字段
+const queryTag = "query"
+
+// modelColumns 模型中允许被 Fields、Order、FuzzyField、Keyword 和 Query 引用的列
+type modelColumns struct {
+	names   map[string]*schema.Field // JSON 名、字段名、列名 -> 字段
+	allowed map[string]bool          // 列名
+	version *schema.Field            // 乐观锁版本列，见 optLockTag
+}
+
+var columnsCache sync.Map // *schema.Schema -> *modelColumns
+
+func columnsOf(conn *gorm.DB, model interface{}) (*modelColumns, *schema.Schema, error) {
+	stmt := &gorm.Statement{DB: conn}
+	if err := stmt.Parse(model); err != nil {
+		return nil, nil, err
+	}
+
+	if c, ok := columnsCache.Load(stmt.Schema); ok {
+		return c.(*modelColumns), stmt.Schema, nil
+	}
+
+	c := newModelColumns(stmt.Schema)
+	columnsCache.Store(stmt.Schema, c)
+
+	return c, stmt.Schema, nil
+}
+
+func newModelColumns(sch *schema.Schema) *modelColumns {
+	var allowMode bool
+	for _, f := range sch.Fields {
+		if f.Tag.Get(queryTag) == "allow" {
+			allowMode = true
+			break
+		}
+	}
+
+	var fields []*schema.Field
+	for _, f := range sch.Fields {
+		tag := f.Tag.Get(queryTag)
+		if f.DBName == "" || tag == "-" || (allowMode && tag != "allow") {
+			continue
+		}
+		fields = append(fields, f)
+	}
+
+	c := &modelColumns{names: make(map[string]*schema.Field), allowed: make(map[string]bool)}
+	for _, f := range sch.Fields {
+		if f.DBName != "" && f.Tag.Get(optLockTag) == "true" {
+			c.version = f
+			break
+		}
+	}
+
+	// 优先级：JSON 名 > 字段名 > 列名
+	for _, f := range fields {
+		c.names[f.DBName] = f
+		c.allowed[f.DBName] = true
+	}
+	for _, f := range fields {
+		c.names[f.Name] = f
+	}
+	for _, f := range fields {
+		if name := strings.Split(f.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+			c.names[name] = f
+		}
+	}
+
+	return c
+}
+
+// lookup 把用户传入的 JSON 名、字段名或列名转换为字段，不存在或不允许引用时返回 ErrInvalidColumn
+func (c *modelColumns) lookup(conn *gorm.DB, name string) (*schema.Field, error) {
+	if f, ok := c.names[name]; ok {
+		return f, nil
+	}
+
+	if f, ok := c.names[conn.NamingStrategy.ColumnName("", name)]; ok {
+		return f, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrInvalidColumn, name)
+}
+
+// keys 允许在 Query 中使用的名称
+func (c *modelColumns) keys() []string {
+	keys := make([]string, 0, len(c.names))
+	for k := range c.names {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+// parseOrder 解析以逗号分隔的排序，如 "Name asc,CreatedAt desc"，方向缺省时为 asc，只能是 asc 或 desc
+func (c *modelColumns) parseOrder(conn *gorm.DB, order string) (keys []keyColumn, err error) {
+	for _, s := range strings.Split(order, ",") {
+		orderKey := strings.Fields(s)
+		if len(orderKey) == 0 {
+			continue
+		}
+		if len(orderKey) > 2 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidColumn, strings.TrimSpace(s))
+		}
+
+		f, e := c.lookup(conn, orderKey[0])
+		if e != nil {
+			return nil, e
+		}
+
+		var desc bool
+		if len(orderKey) == 2 {
+			switch strings.ToLower(orderKey[1]) {
+			case "asc":
+			case "desc":
+				desc = true
+			default:
+				return nil, fmt.Errorf("%w: %s", ErrInvalidColumn, strings.TrimSpace(s))
+			}
+		}
+		keys = append(keys, keyColumn{column: f.DBName, desc: desc})
+	}
+
+	return
+}
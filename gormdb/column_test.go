@@ -0,0 +1,104 @@
+/*
+@Date: 2022/3/28 11:05
+@Author: max.liu
+@File : column_test
+*/
+
+package gormdb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type columnUser struct {
+	Id       int64  `gorm:"primaryKey"`
+	Name     string `json:"user_name"`
+	Password string `json:"password" query:"-"`
+	Version  int64  `optlock:"true"`
+	Profile  string `gorm:"-"`
+}
+
+type allowUser struct {
+	Id    int64  `gorm:"primaryKey" query:"allow"`
+	Name  string `query:"allow"`
+	Email string
+}
+
+type deniedUser struct {
+	Id     int64  `gorm:"primaryKey" query:"-"`
+	Secret string `query:"-"`
+}
+
+func TestModelColumns(t *testing.T) {
+	db := newDryRunDB(t)
+
+	cols, _, err := columnsOf(db, &columnUser{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"Id": true, "Name": true, "Version": true}, cols.allowed)
+	assert.ElementsMatch(t, []string{"Id", "Name", "user_name", "Version"}, cols.keys())
+	assert.Equal(t, "Version", cols.version.Name)
+
+	// JSON 名、字段名都可以引用，query:"-" 和非数据库字段不可引用
+	for name, column := range map[string]string{"user_name": "Name", "Name": "Name", "Id": "Id"} {
+		f, err := cols.lookup(db, name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, column, f.DBName, name)
+	}
+	for _, name := range []string{"Password", "password", "Profile", "Unknown", ""} {
+		_, err = cols.lookup(db, name)
+		assert.ErrorIs(t, err, ErrInvalidColumn, name)
+	}
+
+	// 有字段标记 query:"allow" 时只允许引用这些字段
+	cols, _, err = columnsOf(db, &allowUser{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"Id": true, "Name": true}, cols.allowed)
+	assert.Nil(t, cols.version)
+	_, err = cols.lookup(db, "Email")
+	assert.ErrorIs(t, err, ErrInvalidColumn)
+
+	cols, _, err = columnsOf(db, &deniedUser{})
+	assert.NoError(t, err)
+	assert.Empty(t, cols.keys())
+}
+
+func TestParseOrder(t *testing.T) {
+	db := newDryRunDB(t)
+	cols, _, err := columnsOf(db, &columnUser{})
+	assert.NoError(t, err)
+
+	keys, err := cols.parseOrder(db, "user_name DESC, ,Id asc,Version")
+	assert.NoError(t, err)
+	assert.Equal(t, []keyColumn{{column: "Name", desc: true}, {column: "Id"}, {column: "Version"}}, keys)
+
+	for _, order := range []string{"Name sideways", "Name asc desc", "Password", "Name;drop"} {
+		_, err = cols.parseOrder(db, order)
+		assert.ErrorIs(t, err, ErrInvalidColumn, order)
+	}
+}
+
+func TestListQueryColumns(t *testing.T) {
+	db := newDryRunDB(t)
+
+	var list []columnUser
+	q, err := listQuery(db, BasicQuery{Fields: []string{"user_name"}, Query: "user_name==bob", Order: "Id desc"}, &columnUser{})
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT `Name` FROM `column_users` WHERE `Name` = ? ORDER BY `Id` desc", q.Find(&list).Statement.SQL.String())
+
+	for _, bq := range []BasicQuery{
+		{Fields: []string{"Password"}},
+		{Query: "Password==x"},
+		{Query: "Unknown==x"},
+		{FuzzyField: map[string]string{"Password": "x"}},
+		{Order: "Name sideways"},
+	} {
+		_, err = listQuery(db, bq, &columnUser{})
+		assert.Error(t, err, bq)
+	}
+
+	// 没有可引用的字段时 rsql 不会校验，直接拒绝
+	_, err = listQuery(db, BasicQuery{Query: "Secret==x"}, &deniedUser{})
+	assert.ErrorIs(t, err, ErrInvalidColumn)
+}
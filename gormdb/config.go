@@ -38,6 +38,7 @@ type DBConfig struct {
 	LogLevel        string   `yaml:"log_level" env:"MySQLLogLevel" env-description:"log level of mysql log: silent/info/warn/error"`
 	RawColumn       bool     `yaml:"-"`
 	ConnMaxLifetime int      `yaml:"conn_max_life_time" env:"ConnMaxLifetime" env-description:"please set conn_max_life_time < wait_timeout unit=Minute"`
+	CursorSecret    string   `yaml:"cursor_secret" env:"MySQLCursorSecret" env-description:"secret used to sign pagination cursors"`
 }
 
 func (c *DBConfig) initConfig() (conf *gorm.Config, err error) {
@@ -73,23 +74,37 @@ func (c *DBConfig) initConfig() (conf *gorm.Config, err error) {
 	return
 }
 
-func (c DBConfig) BuildMySQLClient(ctx context.Context) (*DB, error) {
+// BuildMySQLClient 创建单例连接，只有全部成功后才设置单例，失败时关闭已打开的连接池
+func (c DBConfig) BuildMySQLClient(ctx context.Context) (_ *DB, err error) {
 	logger.Debug("build mysql client")
 
 	var master *gorm.DB
 	var sqlDBMaster *sql.DB
+	var replicas []*sql.DB
 
 	if _default != nil {
 		return _default, nil
 	}
 
-	_default = &DB{ctx: ctx}
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, r := range replicas {
+			_ = r.Close()
+		}
+		if sqlDBMaster != nil {
+			_ = sqlDBMaster.Close()
+		}
+	}()
 
 	gormConfig, err := c.initConfig()
 	if err != nil {
 		return nil, err
 	}
 
+	SetCursorSecret(c.CursorSecret)
+
 	createDBDsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/", c.WriteDBUser, c.WriteDBPassword, c.WriteDBHost, c.WriteDBPort)
 	database, err := gorm.Open(mysql.Open(createDBDsn), &gorm.Config{})
 	err = database.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s` DEFAULT CHARACTER SET utf8mb4 COLLATE utf8mb4_general_ci;", c.WriteDB)).Error
@@ -108,6 +123,9 @@ func (c DBConfig) BuildMySQLClient(ctx context.Context) (*DB, error) {
 	if err != nil {
 		return nil, err
 	}
+	if sqlDBMaster, err = master.DB(); err != nil {
+		return nil, err
+	}
 
 	err = master.Use(gormopentracing.New())
 	if err != nil {
@@ -121,7 +139,14 @@ func (c DBConfig) BuildMySQLClient(ctx context.Context) (*DB, error) {
 		}
 
 		dsn := createDSN(c.ReadDBUser, c.ReadDBPassword, host, c.ReadDB, c.ReadDBPort)
-		slaves = append(slaves, mysql.Open(dsn))
+		// 自己持有从库连接池，只读事务需要直接在从库上开启
+		sqlDBSlave, e := sql.Open("mysql", dsn)
+		if e != nil {
+			return nil, e
+		}
+
+		replicas = append(replicas, sqlDBSlave)
+		slaves = append(slaves, mysql.New(mysql.Config{Conn: sqlDBSlave}))
 	}
 
 	if len(slaves) > 0 {
@@ -142,13 +167,7 @@ func (c DBConfig) BuildMySQLClient(ctx context.Context) (*DB, error) {
 		}
 	}
 
-	sqlDBMaster, err = master.DB()
-	if err != nil {
-		return nil, err
-	}
-
-	_default.db = master
-	_default.writeSQL = sqlDBMaster
+	_default = &DB{db: master, writeSQL: sqlDBMaster, replicas: replicas, ctx: ctx}
 
 	return _default, nil
 }
@@ -0,0 +1,203 @@
+/*
+@Date: 2022/3/21 15:10
+@Author: max.liu
+@File : cursor
+*/
+
+package gormdb
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursorSecret 游标签名密钥，默认为进程启动时生成的随机密钥
+var cursorSecret = func() []byte {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return b
+}()
+
+// SetCursorSecret 设置游标签名密钥，多个实例之间传递游标时需要使用相同的密钥
+func SetCursorSecret(secret string) {
+	if secret != "" {
+		cursorSecret = []byte(secret)
+	}
+}
+
+// cursor 记录翻页位置的排序列的值
+type cursor struct {
+	Order  string        `json:"o"` // 排序签名，排序变化后游标失效
+	Prev   bool          `json:"p,omitempty"`
+	Values []cursorValue `json:"v"`
+}
+
+// cursorValue 带类型的值，避免 JSON 数字丢失 int64 精度
+type cursorValue struct {
+	T string `json:"t"`
+	V string `json:"v"`
+}
+
+func (c cursor) encode() (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(signCursor(payload)), nil
+}
+
+func decodeCursor(s, order string) (c cursor, err error) {
+	enc := base64.RawURLEncoding
+	i := strings.IndexByte(s, '.')
+	if i < 0 {
+		return c, ErrInvalidCursor
+	}
+
+	payload, err := enc.DecodeString(s[:i])
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	sig, err := enc.DecodeString(s[i+1:])
+	if err != nil || !hmac.Equal(sig, signCursor(payload)) {
+		return c, ErrInvalidCursor
+	}
+
+	if err = json.Unmarshal(payload, &c); err != nil || c.Order != order {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+func signCursor(payload []byte) []byte {
+	mac := hmac.New(sha256.New, cursorSecret)
+	mac.Write(payload)
+	return mac.Sum(nil)[:16]
+}
+
+func newCursorValue(v interface{}) (cv cursorValue, err error) {
+	if valuer, ok := v.(driver.Valuer); ok {
+		if v, err = valuer.Value(); err != nil {
+			return
+		}
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() || rv.Kind() == reflect.Ptr {
+		return cv, errors.New("cursor column can not be NULL")
+	}
+
+	if t, ok := rv.Interface().(time.Time); ok {
+		return cursorValue{T: "t", V: t.Format(time.RFC3339Nano)}, nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		cv = cursorValue{T: "i", V: strconv.FormatInt(rv.Int(), 10)}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		cv = cursorValue{T: "u", V: strconv.FormatUint(rv.Uint(), 10)}
+	case reflect.Float32, reflect.Float64:
+		cv = cursorValue{T: "f", V: strconv.FormatFloat(rv.Float(), 'g', -1, 64)}
+	case reflect.Bool:
+		cv = cursorValue{T: "b", V: strconv.FormatBool(rv.Bool())}
+	case reflect.String:
+		cv = cursorValue{T: "s", V: rv.String()}
+	default:
+		err = fmt.Errorf("unsupported cursor column type %s", rv.Type())
+	}
+
+	return
+}
+
+func (cv cursorValue) value() (v interface{}, err error) {
+	switch cv.T {
+	case "t":
+		v, err = time.Parse(time.RFC3339Nano, cv.V)
+	case "i":
+		v, err = strconv.ParseInt(cv.V, 10, 64)
+	case "u":
+		v, err = strconv.ParseUint(cv.V, 10, 64)
+	case "f":
+		v, err = strconv.ParseFloat(cv.V, 64)
+	case "b":
+		v, err = strconv.ParseBool(cv.V)
+	case "s":
+		v = cv.V
+	default:
+		err = ErrInvalidCursor
+	}
+
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return
+}
+
+// keyColumn 游标分页的排序列
+type keyColumn struct {
+	column string
+	desc   bool
+}
+
+func (k keyColumn) order(reverse bool) string {
+	if k.desc != reverse {
+		return fmt.Sprintf("`%s` desc", k.column)
+	}
+
+	return fmt.Sprintf("`%s` asc", k.column)
+}
+
+func orderSignature(keys []keyColumn) string {
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k.order(false))
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// keysetCond 生成位于游标之后的条件：(a > ?) OR (a = ? AND b > ?) ...，prev 时方向相反
+func keysetCond(keys []keyColumn, values []interface{}, prev bool) (string, []interface{}) {
+	var stmt bytes.Buffer
+	var args []interface{}
+
+	for i := range keys {
+		if i > 0 {
+			stmt.WriteString(" OR ")
+		}
+
+		stmt.WriteString("(")
+		for j := 0; j < i; j++ {
+			fmt.Fprintf(&stmt, "`%s` = ? AND ", keys[j].column)
+			args = append(args, values[j])
+		}
+
+		op := ">"
+		if keys[i].desc != prev {
+			op = "<"
+		}
+		fmt.Fprintf(&stmt, "`%s` %s ?)", keys[i].column, op)
+		args = append(args, values[i])
+	}
+
+	return stmt.String(), args
+}
@@ -0,0 +1,140 @@
+/*
+@Date: 2022/3/21 15:10
+@Author: max.liu
+@File : cursor_test
+*/
+
+package gormdb
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// newDryRunDB 只生成 SQL 不连接数据库
+func newDryRunDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "user:pass@tcp(127.0.0.1:3306)/test", SkipInitializeWithVersion: true}), &gorm.Config{
+		NamingStrategy:       MyNamingStrategy{},
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+type pageUser struct {
+	Id        int64 `gorm:"primaryKey"`
+	Name      string
+	Score     float64
+	CreatedAt time.Time
+}
+
+func TestCursorEncode(t *testing.T) {
+	created := time.Date(2022, 3, 21, 15, 10, 0, 123456789, time.UTC)
+	c := cursor{Order: "`Name` asc,`Id` asc", Values: []cursorValue{
+		{T: "s", V: "alice"},
+		{T: "i", V: "9007199254740993"},
+		{T: "t", V: created.Format(time.RFC3339Nano)},
+	}}
+
+	s, err := c.encode()
+	assert.NoError(t, err)
+
+	got, err := decodeCursor(s, c.Order)
+	assert.NoError(t, err)
+	assert.Equal(t, c, got)
+
+	// int64 不丢失精度
+	v, err := got.Values[1].value()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(9007199254740993), v)
+	v, err = got.Values[2].value()
+	assert.NoError(t, err)
+	assert.True(t, created.Equal(v.(time.Time)))
+
+	// 排序变化后游标失效
+	_, err = decodeCursor(s, "`Name` desc,`Id` desc")
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestCursorTamper(t *testing.T) {
+	c := cursor{Order: "`Id` asc", Values: []cursorValue{{T: "i", V: "10"}}}
+	s, err := c.encode()
+	assert.NoError(t, err)
+
+	// 替换 payload 中的值，签名不匹配
+	forged := cursor{Order: c.Order, Values: []cursorValue{{T: "i", V: "1"}}}
+	f, err := forged.encode()
+	assert.NoError(t, err)
+	tampered := f[:strings.IndexByte(f, '.')] + s[strings.IndexByte(s, '.'):]
+	_, err = decodeCursor(tampered, c.Order)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	for _, invalid := range []string{"", "abc", s + "x", "!!." + s} {
+		_, err = decodeCursor(invalid, c.Order)
+		assert.ErrorIs(t, err, ErrInvalidCursor, invalid)
+	}
+
+	// 其他密钥签名的游标无效
+	origin := cursorSecret
+	defer func() { cursorSecret = origin }()
+	SetCursorSecret("another secret")
+	_, err = decodeCursor(s, c.Order)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestCursorValue(t *testing.T) {
+	for _, v := range []interface{}{int8(-1), uint64(1 << 63), 1.5, true, "bob"} {
+		cv, err := newCursorValue(v)
+		assert.NoError(t, err)
+		got, err := cv.value()
+		assert.NoError(t, err)
+		assert.EqualValues(t, v, got)
+	}
+
+	// 指针取其指向的值
+	name := "bob"
+	cv, err := newCursorValue(&name)
+	assert.NoError(t, err)
+	assert.Equal(t, cursorValue{T: "s", V: "bob"}, cv)
+
+	var nilName *string
+	_, err = newCursorValue(nilName)
+	assert.Error(t, err)
+	_, err = newCursorValue([]int{1})
+	assert.Error(t, err)
+	_, err = cursorValue{T: "x", V: "1"}.value()
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestKeysetCond(t *testing.T) {
+	keys := []keyColumn{{column: "Name"}, {column: "Score", desc: true}, {column: "Id", desc: true}}
+	values := []interface{}{"alice", 1.5, int64(10)}
+
+	stmt, args := keysetCond(keys, values, false)
+	assert.Equal(t, "(`Name` > ?) OR (`Name` = ? AND `Score` < ?) OR (`Name` = ? AND `Score` = ? AND `Id` < ?)", stmt)
+	assert.Equal(t, []interface{}{"alice", "alice", 1.5, "alice", 1.5, int64(10)}, args)
+
+	stmt, _ = keysetCond(keys, values, true)
+	assert.Equal(t, "(`Name` < ?) OR (`Name` = ? AND `Score` > ?) OR (`Name` = ? AND `Score` = ? AND `Id` > ?)", stmt)
+
+	// 与其他条件组合时整体加括号
+	var list []pageUser
+	stmt, args = keysetCond(keys, values, false)
+	db := newDryRunDB(t).Model(&pageUser{}).Where("`Score` > ?", 0).Where(stmt, args...)
+	for _, k := range keys {
+		db.Order(k.order(false))
+	}
+	sql := db.Find(&list).Statement.SQL.String()
+	assert.Equal(t, "SELECT * FROM `page_users` WHERE (`Score` > ?) AND "+
+		"((`Name` > ?) OR (`Name` = ? AND `Score` < ?) OR (`Name` = ? AND `Score` = ? AND `Id` < ?)) "+
+		"ORDER BY `Name` asc,`Score` desc,`Id` desc", sql)
+}
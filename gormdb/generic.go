@@ -0,0 +1,182 @@
+/*
+@Date: 2022/3/14 10:20
+@Author: max.liu
+@File : generic
+*/
+
+package gormdb
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// Repo 类型安全的 CRUD，T 为模型结构体(非指针)
+// 每个方法都通过 ctx 获取连接：ctx 中有事务时在事务中执行，否则使用带有链路追踪的主库连接
+type Repo[T any] struct {
+	db *DB
+}
+
+// NewRepo db 为 nil 时在每次调用时使用单例 GetDB()
+func NewRepo[T any](db *DB) *Repo[T] {
+	return &Repo[T]{db: db}
+}
+
+func (r *Repo[T]) conn(ctx context.Context) (*gorm.DB, error) {
+	db := r.db
+	if db == nil {
+		db = GetDB()
+	}
+
+	return db.Conn(ctx)
+}
+
+// List 按 BasicQuery 查询列表，total 为分页前的总数，计数方式见 CountMode
+func (r *Repo[T]) List(ctx context.Context, q BasicQuery) (list []T, total int64, err error) {
+	conn, err := r.conn(ctx)
+	if err != nil {
+		return
+	}
+
+	db, err := listQuery(conn, q, new(T))
+	if err != nil {
+		return
+	}
+
+	if total, err = countList(db, q, new(T)); err != nil {
+		return
+	}
+
+	err = paginate(db, q).Find(&list).Error
+
+	return list, total, err
+}
+
+// Page 游标分页，按 Order 和主键排序，用返回的 NextCursor/PrevCursor 设置 Cursor 翻页
+func (r *Repo[T]) Page(ctx context.Context, q BasicQuery) (list []T, page PageInfo, err error) {
+	conn, err := r.conn(ctx)
+	if err != nil {
+		return
+	}
+
+	page, err = getPage(conn, q, new(T), &list)
+
+	return
+}
+
+// Get 按主键查询，不存在时返回 gorm.ErrRecordNotFound
+func (r *Repo[T]) Get(ctx context.Context, id int64) (*T, error) {
+	conn, err := r.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m := new(T)
+	if err = conn.First(m, id).Error; err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// FindBy cond 可以是模型结构体指针、map 或带占位符的字符串
+func (r *Repo[T]) FindBy(ctx context.Context, cond interface{}, args ...interface{}) (list []T, err error) {
+	conn, err := r.conn(ctx)
+	if err != nil {
+		return
+	}
+
+	err = conn.Where(cond, args...).Find(&list).Error
+
+	return
+}
+
+func (r *Repo[T]) Create(ctx context.Context, m *T) error {
+	conn, err := r.conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	return conn.Create(m).Error
+}
+
+// Update 按主键更新 u 中的字段，记录不存在时不返回错误
+// 有 optlock 版本列的模型无法检查版本，返回 ErrUnversionedUpdate，需要使用 UpdateModel
+func (r *Repo[T]) Update(ctx context.Context, id int64, u map[string]interface{}) error {
+	conn, err := r.conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	m := new(T)
+	cols, _, err := columnsOf(conn, m)
+	if err != nil {
+		return err
+	}
+	if cols.version != nil {
+		return ErrUnversionedUpdate
+	}
+
+	return conn.Model(m).Where(id).Updates(u).Error
+}
+
+// UpdateModel 保存 m 的所有字段，有 optlock 版本列时版本号变化后返回 ErrStaleObject
+func (r *Repo[T]) UpdateModel(ctx context.Context, m *T) error {
+	conn, err := r.conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	return updateModel(conn, m)
+}
+
+// Delete 按主键删除，hardDelete 为 true 时忽略软删除
+func (r *Repo[T]) Delete(ctx context.Context, id int64, hardDelete bool) error {
+	conn, err := r.conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	if hardDelete {
+		conn = conn.Unscoped()
+	}
+
+	return conn.Delete(new(T), id).Error
+}
+
+// Exists 是否存在满足条件的记录，cond 为 nil 时判断表中是否有记录
+func (r *Repo[T]) Exists(ctx context.Context, cond interface{}, args ...interface{}) (bool, error) {
+	conn, err := r.conn(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	err = where(conn, cond, args...).Select("1").Take(new(T)).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// Count 满足条件的记录数，cond 为 nil 时统计全部
+func (r *Repo[T]) Count(ctx context.Context, cond interface{}, args ...interface{}) (total int64, err error) {
+	conn, err := r.conn(ctx)
+	if err != nil {
+		return
+	}
+
+	err = where(conn.Model(new(T)), cond, args...).Count(&total).Error
+
+	return
+}
+
+func where(db *gorm.DB, cond interface{}, args ...interface{}) *gorm.DB {
+	if cond == nil {
+		return db
+	}
+
+	return db.Where(cond, args...)
+}
@@ -0,0 +1,80 @@
+/*
+@Date: 2022/3/14 10:20
+@Author: max.liu
+@File : generic_test
+*/
+
+package gormdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type repoUser struct {
+	Id        int64 `gorm:"primaryKey"`
+	Name      string
+	DeletedAt gorm.DeletedAt
+}
+
+func TestRepo(t *testing.T) {
+	conn := &fakeConn{rowsAffected: 1, lastInsertId: 7}
+	repo := NewRepo[repoUser](&DB{db: newFakeDB(t, conn)})
+	ctx := context.Background()
+
+	_, err := repo.Get(ctx, 1)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	_, total, err := repo.List(ctx, BasicQuery{Query: "Name==bob", Order: "Id desc", Limit: 10, Offset: 20})
+	assert.NoError(t, err)
+	assert.Zero(t, total)
+
+	_, err = repo.FindBy(ctx, "Name = ?", "bob")
+	assert.NoError(t, err)
+
+	m := &repoUser{Name: "bob"}
+	assert.NoError(t, repo.Create(ctx, m))
+	assert.Equal(t, int64(7), m.Id)
+
+	assert.NoError(t, repo.Delete(ctx, 1, false))
+	assert.NoError(t, repo.Delete(ctx, 1, true))
+
+	ok, err := repo.Exists(ctx, map[string]interface{}{"Name": "bob"})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	n, err := repo.Count(ctx, nil)
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+
+	assert.Equal(t, []string{
+		"SELECT * FROM `repo_users` WHERE `repo_users`.`Id` = ? AND `repo_users`.`DeletedAt` IS NULL ORDER BY `repo_users`.`Id` LIMIT 1",
+		"SELECT count(*) FROM `repo_users` WHERE `Name` = ? AND `repo_users`.`DeletedAt` IS NULL",
+		"SELECT * FROM `repo_users` WHERE `Name` = ? AND `repo_users`.`DeletedAt` IS NULL ORDER BY `Id` desc LIMIT 10 OFFSET 20",
+		"SELECT * FROM `repo_users` WHERE Name = ? AND `repo_users`.`DeletedAt` IS NULL",
+		"INSERT INTO `repo_users` (`Name`,`DeletedAt`) VALUES (?,?)",
+		// 软删除
+		"UPDATE `repo_users` SET `DeletedAt`=? WHERE `repo_users`.`Id` = ? AND `repo_users`.`DeletedAt` IS NULL",
+		"DELETE FROM `repo_users` WHERE `repo_users`.`Id` = ?",
+		"SELECT 1 FROM `repo_users` WHERE `Name` = ? AND `repo_users`.`DeletedAt` IS NULL LIMIT 1",
+		"SELECT count(*) FROM `repo_users` WHERE `repo_users`.`DeletedAt` IS NULL",
+	}, conn.execs)
+	assert.Equal(t, []interface{}{int64(1)}, conn.args[0])
+	assert.Equal(t, []interface{}{"bob"}, conn.args[2])
+}
+
+func TestRepoContext(t *testing.T) {
+	conn := &fakeConn{rowsAffected: 1}
+	repo := NewRepo[repoUser](&DB{db: newFakeDB(t, conn)})
+
+	// 没有链路信息时 ctx 的取消同样生效
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := repo.Get(ctx, 1)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, repo.Create(ctx, &repoUser{Name: "bob"}), context.Canceled)
+	assert.Empty(t, conn.execs)
+}
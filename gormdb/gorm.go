@@ -30,26 +30,35 @@ func GetDB() *DB {
 	return _default
 }
 
-// Cli is a shortcut
+// Cli is a shortcut, ctx 中有 WithTx 开启的事务时返回该事务
 func Cli(ctx context.Context) *gorm.DB {
+	if tx := TxFromContext(ctx); tx != nil {
+		return tx.Session(&gorm.Session{NewDB: true})
+	}
+
 	return GetDB().Master(ctx)
 }
 
 type DB struct {
 	db       *gorm.DB
 	writeSQL *sql.DB
+	replicas []*sql.DB // 从库连接，用于只读事务
 	ctx      context.Context
 }
 
 // Master check *gorm.DB if is nil
+// 返回绑定了 ctx 的连接，ctx 中有链路信息时使用带有 span 的 ctx，ctx 的截止时间和取消对查询生效
 func (d *DB) Master(ctx context.Context) *gorm.DB {
 	if d == nil {
 		return nil
 	}
+	if d.db == nil || ctx == nil {
+		return d.db
+	}
 
 	spanCtx, err := gadget.ExtractTraceSpan(ctx)
 	if err != nil {
-		return d.db
+		return d.db.WithContext(ctx)
 	}
 
 	return d.db.WithContext(spanCtx)
@@ -72,5 +81,11 @@ func (d *DB) Close() (err error) {
 		err = d.writeSQL.Close()
 	}
 
+	for _, r := range d.replicas {
+		if e := r.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+
 	return
 }
@@ -14,10 +14,18 @@ import (
 	"time"
 
 	"github.com/maxliu9403/common/logger"
+	"go.uber.org/zap"
 	logg "gorm.io/gorm/logger"
 	"gorm.io/gorm/utils"
 )
 
+// logModule gorm 日志使用的模块名，可通过 logger.SetLevel 单独调整级别
+const logModule = "gormdb"
+
+func dbLog(ctx context.Context) *zap.SugaredLogger {
+	return logger.NamedSkip(logModule).With(logger.ContextFields(ctx)...)
+}
+
 type DBLog struct {
 	logg.Config
 }
@@ -33,7 +41,7 @@ func (d DBLog) Info(ctx context.Context, msg string, data ...interface{}) {
 		return
 	}
 
-	logger.InfofWithTrace(ctx, msg, data)
+	dbLog(ctx).Infof(msg, data)
 }
 
 func (d DBLog) Warn(ctx context.Context, msg string, data ...interface{}) {
@@ -41,7 +49,7 @@ func (d DBLog) Warn(ctx context.Context, msg string, data ...interface{}) {
 		return
 	}
 
-	logger.WarnfWithTrace(ctx, msg, data)
+	dbLog(ctx).Warnf(msg, data)
 }
 
 func (d DBLog) Error(ctx context.Context, msg string, data ...interface{}) {
@@ -49,7 +57,7 @@ func (d DBLog) Error(ctx context.Context, msg string, data ...interface{}) {
 		return
 	}
 
-	logger.ErrorfWithTrace(ctx, msg, data)
+	dbLog(ctx).Errorf(msg, data)
 }
 
 func (d DBLog) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
@@ -66,24 +74,24 @@ func (d DBLog) Trace(ctx context.Context, begin time.Time, fc func() (sql string
 	case err != nil && d.LogLevel >= logg.Error && (!errors.Is(err, logg.ErrRecordNotFound) || !d.IgnoreRecordNotFoundError):
 		sql, rows := fc()
 		if rows == -1 {
-			logger.ErrorfWithTrace(ctx, "call by %s get an error: %s, cost %f - sql is %s", filePath, err.Error(), float64(elapsed.Nanoseconds())/1e6, sql)
+			dbLog(ctx).Errorf("call by %s get an error: %s, cost %f - sql is %s", filePath, err.Error(), float64(elapsed.Nanoseconds())/1e6, sql)
 		} else {
-			logger.ErrorfWithTrace(ctx, "call by %s get an error: %s, cost %f, affected %d records with sql %s", filePath, err.Error(), float64(elapsed.Nanoseconds())/1e6, rows, sql)
+			dbLog(ctx).Errorf("call by %s get an error: %s, cost %f, affected %d records with sql %s", filePath, err.Error(), float64(elapsed.Nanoseconds())/1e6, rows, sql)
 		}
 	case elapsed > d.SlowThreshold && d.SlowThreshold != 0 && d.LogLevel >= logg.Warn:
 		sql, rows := fc()
 		slowLog := fmt.Sprintf("SLOW SQL >= %v", d.SlowThreshold)
 		if rows == -1 {
-			logger.WarnfWithTrace(ctx, "call by %s show %s, cost %f - sql is %s", filePath, slowLog, float64(elapsed.Nanoseconds())/1e6, sql)
+			dbLog(ctx).Warnf("call by %s show %s, cost %f - sql is %s", filePath, slowLog, float64(elapsed.Nanoseconds())/1e6, sql)
 		} else {
-			logger.WarnfWithTrace(ctx, "call by %s show %s, cost %f, affected %d records with sql %s", filePath, slowLog, float64(elapsed.Nanoseconds())/1e6, rows, sql)
+			dbLog(ctx).Warnf("call by %s show %s, cost %f, affected %d records with sql %s", filePath, slowLog, float64(elapsed.Nanoseconds())/1e6, rows, sql)
 		}
 	case d.LogLevel == logg.Info:
 		sql, rows := fc()
 		if rows == -1 {
-			logger.InfofWithTrace(ctx, "call by %s, cost %f - sql is %s", filePath, float64(elapsed.Nanoseconds())/1e6, sql)
+			dbLog(ctx).Infof("call by %s, cost %f - sql is %s", filePath, float64(elapsed.Nanoseconds())/1e6, sql)
 		} else {
-			logger.InfofWithTrace(ctx, "call by %s, cost %f, affected %d records with sql %s", filePath, float64(elapsed.Nanoseconds())/1e6, rows, sql)
+			dbLog(ctx).Infof("call by %s, cost %f, affected %d records with sql %s", filePath, float64(elapsed.Nanoseconds())/1e6, rows, sql)
 		}
 	}
 }
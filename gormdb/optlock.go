@@ -0,0 +1,147 @@
+/*
+@Date: 2022/4/6 14:40
+@Author: max.liu
+@File : optlock
+*/
+
+package gormdb
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// optLockTag 标记乐观锁版本列，如 `gorm:"column:Version" optlock:"true"`，版本列须为整数类型
+const optLockTag = "optlock"
+
+var ErrStaleObject = errors.New("stale object")
+
+// ErrUnversionedUpdate 有版本列的模型不能不带版本号更新
+var ErrUnversionedUpdate = errors.New("optlock model must be updated with its version, use UpdateModel")
+
+// StaleObjectError 更新时版本号不匹配，记录已被其它请求修改或删除，errors.Is(err, ErrStaleObject) 为 true
+type StaleObjectError struct {
+	Table   string
+	Version int64 // 更新前模型中的版本号
+}
+
+func (e *StaleObjectError) Error() string {
+	return fmt.Sprintf("%s: %s version %d has been modified", ErrStaleObject, e.Table, e.Version)
+}
+
+func (e *StaleObjectError) Unwrap() error {
+	return ErrStaleObject
+}
+
+// lockedModel 带有版本列的模型
+type lockedModel struct {
+	cols    *modelColumns
+	table   string
+	value   reflect.Value
+	version int64
+}
+
+// optLockOf 模型没有版本列时返回 nil
+func optLockOf(conn *gorm.DB, model interface{}) (*lockedModel, error) {
+	cols, sch, err := columnsOf(conn, model)
+	if err != nil || cols.version == nil {
+		return nil, err
+	}
+
+	rv := reflect.ValueOf(model)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return nil, gorm.ErrInvalidValue
+	}
+	rv = rv.Elem()
+
+	// 没有主键时 WHERE 只剩版本条件，会更新所有版本相同的记录
+	if sch.PrioritizedPrimaryField == nil {
+		return nil, gorm.ErrPrimaryKeyRequired
+	}
+	if _, zero := sch.PrioritizedPrimaryField.ValueOf(rv); zero {
+		return nil, gorm.ErrPrimaryKeyRequired
+	}
+
+	v, _ := cols.version.ValueOf(rv)
+	var version int64
+	switch vv := reflect.Indirect(reflect.ValueOf(v)); vv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		version = vv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		version = int64(vv.Uint())
+	default:
+		return nil, fmt.Errorf("optlock column %s must be an integer", cols.version.Name)
+	}
+
+	return &lockedModel{cols: cols, table: sch.Table, value: rv, version: version}, nil
+}
+
+func (m *lockedModel) where(db *gorm.DB) *gorm.DB {
+	return db.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: m.cols.version.DBName}, Value: m.version})
+}
+
+func (m *lockedModel) result(tx *gorm.DB) error {
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return &StaleObjectError{Table: m.table, Version: m.version}
+	}
+
+	return nil
+}
+
+// updateWithMap 有版本列时只在版本号未变化时更新，并把版本号加一
+func updateWithMap(conn *gorm.DB, model interface{}, u map[string]interface{}) error {
+	m, err := optLockOf(conn, model)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return conn.Model(model).Updates(u).Error
+	}
+
+	f := m.cols.version
+	values := make(map[string]interface{}, len(u)+1)
+	for k, v := range u {
+		if k != f.Name && k != f.DBName {
+			values[k] = v
+		}
+	}
+	values[f.DBName] = m.version + 1
+
+	// gorm 会把 values 写回模型，失败时恢复版本号
+	if err = m.result(m.where(conn.Model(model)).Updates(values)); err != nil {
+		_ = f.Set(m.value, m.version)
+		return err
+	}
+
+	return f.Set(m.value, m.version+1)
+}
+
+// updateModel 保存模型的所有字段，不会插入新记录；有版本列时同 updateWithMap
+func updateModel(conn *gorm.DB, model interface{}) error {
+	m, err := optLockOf(conn, model)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return conn.Model(model).Select("*").Updates(model).Error
+	}
+
+	f := m.cols.version
+	if err = f.Set(m.value, m.version+1); err != nil {
+		return err
+	}
+
+	if err = m.result(m.where(conn.Model(model)).Select("*").Updates(model)); err != nil {
+		_ = f.Set(m.value, m.version)
+		return err
+	}
+
+	return nil
+}
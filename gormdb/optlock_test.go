@@ -0,0 +1,177 @@
+/*
+@Date: 2022/4/6 14:40
+@Author: max.liu
+@File : optlock_test
+*/
+
+package gormdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// fakeConn 记录执行的语句，Exec 返回 rowsAffected 和 lastInsertId，Query 返回空结果
+type fakeConn struct {
+	lock         sync.Mutex
+	execs        []string
+	args         [][]interface{}
+	rowsAffected int64
+	lastInsertId int64
+}
+
+func (c *fakeConn) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c *fakeConn) Driver() driver.Driver                        { return nil }
+func (c *fakeConn) Prepare(string) (driver.Stmt, error)          { return nil, errors.New("not supported") }
+func (c *fakeConn) Close() error                                 { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                    { return c, nil }
+func (c *fakeConn) Commit() error                                { return nil }
+func (c *fakeConn) Rollback() error                              { return nil }
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.record(query, args)
+
+	return fakeResult{rowsAffected: c.rowsAffected, lastInsertId: c.lastInsertId}, nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.record(query, args)
+
+	return emptyRows{}, nil
+}
+
+func (c *fakeConn) record(query string, args []driver.NamedValue) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	values := make([]interface{}, 0, len(args))
+	for _, a := range args {
+		values = append(values, a.Value)
+	}
+	c.execs = append(c.execs, query)
+	c.args = append(c.args, values)
+}
+
+type fakeResult struct {
+	rowsAffected int64
+	lastInsertId int64
+}
+
+func (r fakeResult) LastInsertId() (int64, error) { return r.lastInsertId, nil }
+func (r fakeResult) RowsAffected() (int64, error) { return r.rowsAffected, nil }
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string         { return nil }
+func (emptyRows) Close() error              { return nil }
+func (emptyRows) Next([]driver.Value) error { return io.EOF }
+
+func newFakeDB(t *testing.T, conn *fakeConn) *gorm.DB {
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sql.OpenDB(conn), SkipInitializeWithVersion: true}), &gorm.Config{
+		NamingStrategy:       MyNamingStrategy{},
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+type lockedUser struct {
+	Id      int64 `gorm:"primaryKey"`
+	Name    string
+	Version int `optlock:"true"`
+}
+
+func TestOptLockOf(t *testing.T) {
+	db := newDryRunDB(t)
+
+	m, err := optLockOf(db, &lockedUser{Id: 1, Version: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), m.version)
+	assert.Equal(t, "locked_users", m.table)
+
+	m, err = optLockOf(db, &columnUser{Id: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), m.version)
+
+	m, err = optLockOf(db, &allowUser{Id: 1})
+	assert.NoError(t, err)
+	assert.Nil(t, m)
+
+	// 没有主键值时会更新所有版本相同的记录
+	_, err = optLockOf(db, &lockedUser{Version: 3})
+	assert.ErrorIs(t, err, gorm.ErrPrimaryKeyRequired)
+	_, err = optLockOf(db, lockedUser{Id: 1})
+	assert.ErrorIs(t, err, gorm.ErrInvalidValue)
+
+	type stringVersion struct {
+		Id      int64  `gorm:"primaryKey"`
+		Version string `optlock:"true"`
+	}
+	_, err = optLockOf(db, &stringVersion{Id: 1})
+	assert.Error(t, err)
+}
+
+func TestUpdateWithMap(t *testing.T) {
+	conn := &fakeConn{rowsAffected: 1}
+	db := newFakeDB(t, conn)
+
+	// 忽略 u 中的版本号，按模型中的版本号检查
+	m := &lockedUser{Id: 1, Version: 3}
+	assert.NoError(t, updateWithMap(db, m, map[string]interface{}{"Name": "bob", "Version": 10}))
+	assert.Equal(t, 4, m.Version)
+	assert.Equal(t, []string{"UPDATE `locked_users` SET `Name`=?,`Version`=? WHERE `locked_users`.`Version` = ? AND `Id` = ?"}, conn.execs)
+	assert.Equal(t, []interface{}{"bob", int64(4), int64(3), int64(1)}, conn.args[0])
+
+	conn.rowsAffected = 0
+	err := updateWithMap(db, m, map[string]interface{}{"Name": "alice"})
+	assert.ErrorIs(t, err, ErrStaleObject)
+	var stale *StaleObjectError
+	if assert.True(t, errors.As(err, &stale)) {
+		assert.Equal(t, "locked_users", stale.Table)
+		assert.Equal(t, int64(4), stale.Version)
+	}
+	assert.Equal(t, 4, m.Version)
+
+	// 没有版本列时不检查影响行数
+	assert.NoError(t, updateWithMap(db, &allowUser{Id: 1}, map[string]interface{}{"Name": "bob"}))
+}
+
+func TestUpdateModel(t *testing.T) {
+	conn := &fakeConn{rowsAffected: 1}
+	db := newFakeDB(t, conn)
+
+	m := &lockedUser{Id: 1, Name: "bob", Version: 3}
+	assert.NoError(t, updateModel(db, m))
+	assert.Equal(t, 4, m.Version)
+	assert.Equal(t, []string{"UPDATE `locked_users` SET `Name`=?,`Version`=? WHERE `locked_users`.`Version` = ? AND `Id` = ?"}, conn.execs)
+	assert.Equal(t, []interface{}{"bob", int64(4), int64(3), int64(1)}, conn.args[0])
+
+	// 更新失败时恢复版本号
+	conn.rowsAffected = 0
+	assert.ErrorIs(t, updateModel(db, m), ErrStaleObject)
+	assert.Equal(t, 4, m.Version)
+}
+
+func TestRepoUpdate(t *testing.T) {
+	conn := &fakeConn{rowsAffected: 1}
+	db := &DB{db: newFakeDB(t, conn)}
+
+	err := NewRepo[lockedUser](db).Update(context.Background(), 1, map[string]interface{}{"Name": "bob"})
+	assert.ErrorIs(t, err, ErrUnversionedUpdate)
+	assert.Empty(t, conn.execs)
+
+	assert.NoError(t, NewRepo[allowUser](db).Update(context.Background(), 1, map[string]interface{}{"Name": "bob"}))
+	assert.Equal(t, []string{"UPDATE `allow_users` SET `Name`=? WHERE `allow_users`.`Id` = ?"}, conn.execs)
+}
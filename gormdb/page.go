@@ -0,0 +1,241 @@
+/*
+@Date: 2022/3/21 15:10
+@Author: max.liu
+@File : page
+*/
+
+package gormdb
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// CountMode 列表的计数方式
+type CountMode string
+
+const (
+	CountExact    CountMode = ""         // 精确计数，执行 COUNT(*)
+	CountNone     CountMode = "none"     // 不计数，total 为 -1
+	CountEstimate CountMode = "estimate" // 估算，无筛选条件时读取 information_schema，否则读取 EXPLAIN 的行数
+)
+
+type PageInfo struct {
+	Total      int64  `json:"Total"`      // 总数，CountNone 时为 -1
+	NextCursor string `json:"NextCursor"` // 下一页的游标，没有下一页时为空
+	PrevCursor string `json:"PrevCursor"` // 上一页的游标，没有上一页时为空
+}
+
+// countList 按 mode 计数，db 为不含排序和分页的查询
+func countList(db *gorm.DB, q BasicQuery, model interface{}) (total int64, err error) {
+	switch q.CountMode {
+	case CountExact:
+		err = db.Count(&total).Error
+	case CountNone:
+		total = -1
+	case CountEstimate:
+		total, err = estimateCount(db, q, model)
+	default:
+		err = fmt.Errorf("unsupported count mode %q", q.CountMode)
+	}
+
+	return
+}
+
+func estimateCount(db *gorm.DB, q BasicQuery, model interface{}) (total int64, err error) {
+	conn := db.Session(&gorm.Session{NewDB: true})
+
+	// 没有筛选条件时直接读取表的统计信息，包含软删除的记录
+	_, hasWhere := db.Statement.Clauses["WHERE"]
+	if !hasWhere && len(q.IDList) == 0 && len(q.FuzzyField) == 0 && q.Keyword == "" && q.Query == "" {
+		stmt := &gorm.Statement{DB: db}
+		if err = stmt.Parse(model); err != nil {
+			return
+		}
+
+		var rows sql.NullInt64
+		err = conn.Raw("SELECT TABLE_ROWS FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?", stmt.Table).
+			Scan(&rows).Error
+
+		return rows.Int64, err
+	}
+
+	var dest []map[string]interface{}
+	stmt := db.Session(&gorm.Session{DryRun: true}).Find(&dest).Statement
+	if stmt.Error != nil {
+		return 0, stmt.Error
+	}
+
+	var plan []map[string]interface{}
+	if err = conn.Raw("EXPLAIN "+stmt.SQL.String(), stmt.Vars...).Scan(&plan).Error; err != nil || len(plan) == 0 {
+		return
+	}
+
+	// 第一行为驱动表，rows * filtered% 为优化器估计的结果行数
+	filtered := explainNumber(plan[0]["filtered"])
+	if filtered <= 0 {
+		filtered = 100
+	}
+
+	return int64(explainNumber(plan[0]["rows"]) * filtered / 100), nil
+}
+
+func explainNumber(v interface{}) float64 {
+	var s string
+	switch n := v.(type) {
+	case []byte:
+		s = string(n)
+	case nil:
+		return 0
+	default:
+		s = fmt.Sprint(n)
+	}
+
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+// keyColumns 解析 Order 中的排序列，并追加主键保证排序稳定
+func keyColumns(conn *gorm.DB, order string, model interface{}) (keys []keyColumn, sch *schema.Schema, err error) {
+	cols, sch, err := columnsOf(conn, model)
+	if err != nil {
+		return
+	}
+
+	pk := sch.PrioritizedPrimaryField
+	if pk == nil {
+		return nil, nil, fmt.Errorf("cursor pagination requires a primary key on %s", sch.Name)
+	}
+
+	if keys, err = cols.parseOrder(conn, order); err != nil {
+		return nil, nil, err
+	}
+
+	// 主键之后的排序列没有意义
+	for i, k := range keys {
+		if k.column == pk.DBName {
+			return keys[:i+1], sch, nil
+		}
+	}
+
+	desc := len(keys) > 0 && keys[len(keys)-1].desc
+	keys = append(keys, keyColumn{column: pk.DBName, desc: desc})
+
+	return
+}
+
+// getPage 游标分页：按 Order 和主键排序，Cursor 为空时返回第一页，忽略 Offset
+func getPage(conn *gorm.DB, q BasicQuery, model, list interface{}) (page PageInfo, err error) {
+	keys, sch, err := keyColumns(conn, q.Order, model)
+	if err != nil {
+		return
+	}
+
+	signature := orderSignature(keys)
+	var after *cursor
+	if q.Cursor != "" {
+		c, e := decodeCursor(q.Cursor, signature)
+		if e != nil || len(c.Values) != len(keys) {
+			return page, ErrInvalidCursor
+		}
+		after = &c
+	}
+
+	base := q
+	base.Order = ""
+	db, err := listQuery(conn, base, model)
+	if err != nil {
+		return
+	}
+
+	// 指定字段时必须包含排序列，否则无法生成游标
+	if selects := db.Statement.Selects; len(selects) > 0 {
+		for _, k := range keys {
+			if !lo.Contains(selects, k.column) {
+				selects = append(selects, k.column)
+			}
+		}
+		db.Select(selects)
+	}
+
+	if page.Total, err = countList(db, q, model); err != nil {
+		return
+	}
+
+	prev := after != nil && after.Prev
+	if after != nil {
+		values := make([]interface{}, len(after.Values))
+		for i, cv := range after.Values {
+			if values[i], err = cv.value(); err != nil {
+				return
+			}
+		}
+		stmt, args := keysetCond(keys, values, prev)
+		db.Where(stmt, args...)
+	}
+
+	for _, k := range keys {
+		db.Order(k.order(prev))
+	}
+
+	// 多取一条判断是否还有下一页
+	if q.Limit > 0 {
+		db.Limit(q.Limit + 1)
+	}
+
+	if err = db.Find(list).Error; err != nil {
+		return
+	}
+
+	rv := reflect.ValueOf(list).Elem()
+	hasMore := q.Limit > 0 && rv.Len() > q.Limit
+	if hasMore {
+		rv.Set(rv.Slice(0, q.Limit))
+	}
+	n := rv.Len()
+	if prev {
+		swap := reflect.Swapper(rv.Interface())
+		for i := 0; i < n/2; i++ {
+			swap(i, n-1-i)
+		}
+	}
+
+	if n == 0 {
+		return
+	}
+
+	encode := func(row reflect.Value, prev bool) (string, error) {
+		c := cursor{Order: signature, Prev: prev}
+		for _, k := range keys {
+			v, _ := sch.LookUpField(k.column).ValueOf(reflect.Indirect(row))
+			cv, e := newCursorValue(v)
+			if e != nil {
+				return "", e
+			}
+			c.Values = append(c.Values, cv)
+		}
+
+		return c.encode()
+	}
+
+	// 正向翻页时多取到记录说明有下一页，反向翻页时总能回到下一页
+	if hasMore || prev {
+		if page.NextCursor, err = encode(rv.Index(n-1), false); err != nil {
+			return
+		}
+	}
+	// 反向翻页时多取到记录说明有上一页，正向翻页时带有游标说明不是第一页
+	if (prev && hasMore) || (!prev && after != nil) {
+		if page.PrevCursor, err = encode(rv.Index(0), true); err != nil {
+			return
+		}
+	}
+
+	return
+}
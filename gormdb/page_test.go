@@ -0,0 +1,54 @@
+/*
+@Date: 2022/3/21 15:10
+@Author: max.liu
+@File : page_test
+*/
+
+package gormdb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyColumns(t *testing.T) {
+	db := newDryRunDB(t)
+
+	cases := []struct {
+		order string
+		keys  []keyColumn
+	}{
+		{"", []keyColumn{{column: "Id"}}},
+		// 主键与最后一个排序列方向相同
+		{"Name desc", []keyColumn{{column: "Name", desc: true}, {column: "Id", desc: true}}},
+		{"Score desc,Name", []keyColumn{{column: "Score", desc: true}, {column: "Name"}, {column: "Id"}}},
+		// 主键之后的排序列被忽略
+		{"Id desc,Name", []keyColumn{{column: "Id", desc: true}}},
+	}
+	for _, c := range cases {
+		keys, sch, err := keyColumns(db, c.order, &pageUser{})
+		assert.NoError(t, err, c.order)
+		assert.Equal(t, c.keys, keys, c.order)
+		assert.Equal(t, "page_users", sch.Table)
+	}
+
+	assert.Equal(t, "`Score` desc,`Name` asc,`Id` asc", orderSignature(cases[2].keys))
+
+	_, _, err := keyColumns(db, "Unknown", &pageUser{})
+	assert.ErrorIs(t, err, ErrInvalidColumn)
+
+	type noPrimaryKey struct {
+		Name string
+	}
+	_, _, err = keyColumns(db, "Name", &noPrimaryKey{})
+	assert.Error(t, err)
+}
+
+func TestExplainNumber(t *testing.T) {
+	assert.Equal(t, 12.5, explainNumber([]byte("12.5")))
+	assert.Equal(t, 3.0, explainNumber(int64(3)))
+	assert.Equal(t, 100.0, explainNumber("100.00"))
+	assert.Equal(t, 0.0, explainNumber(nil))
+	assert.Equal(t, 0.0, explainNumber("NULL"))
+}
@@ -19,6 +19,11 @@ type CRUDImpl struct {
 	Conn *gorm.DB
 }
 
+var (
+	_ GetPageCrud     = (*CRUDImpl)(nil)
+	_ UpdateModelCrud = (*CRUDImpl)(nil)
+)
+
 func NewCRUD(conn *gorm.DB) BasicCrud {
 	return &CRUDImpl{Conn: conn}
 }
@@ -36,11 +41,51 @@ func (c *CRUDImpl) GetList(q BasicQuery, model, list interface{}) (total int64,
 	if err = c.checkConn(); err != nil {
 		return
 	}
-	db := c.Conn.Model(model)
+
+	db, err := listQuery(c.Conn, q, model)
+	if err != nil {
+		return
+	}
+
+	if total, err = countList(db, q, model); err != nil {
+		return
+	}
+
+	err = paginate(db, q).Find(list).Error
+
+	return total, err
+}
+
+// GetPage 游标分页，model and list must be a pointer
+func (c *CRUDImpl) GetPage(q BasicQuery, model, list interface{}) (page PageInfo, err error) {
+	if err = c.checkConn(); err != nil {
+		return
+	}
+
+	return getPage(c.Conn, q, model, list)
+}
+
+// listQuery 根据 BasicQuery 构造查询条件和排序，不包含分页
+// 用户传入的字段名均按模型的 gorm schema 校验，见 queryTag
+func listQuery(conn *gorm.DB, q BasicQuery, model interface{}) (db *gorm.DB, err error) {
+	cols, _, err := columnsOf(conn, model)
+	if err != nil {
+		return
+	}
+
+	db = conn.Model(model)
 
 	// 指定字段
 	if len(q.Fields) > 0 {
-		db.Select(strings.Join(q.Fields, ", "))
+		selects := make([]string, 0, len(q.Fields))
+		for _, name := range q.Fields {
+			f, e := cols.lookup(conn, strings.TrimSpace(name))
+			if e != nil {
+				return nil, e
+			}
+			selects = append(selects, f.DBName)
+		}
+		db.Select(selects)
 	}
 
 	// 基于id查询
@@ -49,38 +94,50 @@ func (c *CRUDImpl) GetList(q BasicQuery, model, list interface{}) (total int64,
 	}
 
 	// 精确字段模糊匹配
-	if len(q.FuzzyField) > 0 {
-		m := gadget.JsonTagColumnMapFromModel(model, db)
-		for j, v := range q.FuzzyField {
-			column, ok := m[j]
-			if !ok {
-				column = j
-			}
-			db.Scopes(KeywordGenerator([]string{column}, v))
+	for name, v := range q.FuzzyField {
+		f, e := cols.lookup(conn, name)
+		if e != nil {
+			return nil, e
 		}
+		db.Scopes(KeywordGenerator([]string{f.DBName}, v))
 	}
 
 	// 全局模糊
 	if q.Keyword != "" {
-		fields := gadget.FieldsFromModel(model, db, true).GetFuzzyField()
-		db.Scopes(KeywordGenerator(fields, q.Keyword))
+		var fields []string
+		for _, column := range gadget.FieldsFromModel(model, db, true).GetFuzzyField() {
+			if cols.allowed[column] {
+				fields = append(fields, column)
+			}
+		}
+		if len(fields) > 0 {
+			db.Scopes(KeywordGenerator(fields, q.Keyword))
+		}
 	}
 
-	parseColumnFunc := func(s string) string { return c.Conn.NamingStrategy.ColumnName("", s) }
-
 	// 自定义查询条件
 	if q.Query != "" {
-		// 把传递过来的Query字段通过gorm的字段命名策略转义成数据库字段
+		// rsql 在允许列表为空时不做校验，模型没有可引用的字段时直接拒绝
+		keys := cols.keys()
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("%w: no column of %T can be queried", ErrInvalidColumn, model)
+		}
+
+		// 把传递过来的Query字段转换成数据库字段，只允许使用模型中可引用的字段
+		parseColumnFunc := func(s string) string {
+			if f, e := cols.lookup(conn, s); e == nil {
+				return f.DBName
+			}
+			return s
+		}
 		preParser, e := rsql.NewPreParser(rsql.MysqlPre(parseColumnFunc))
 		if e != nil {
-			err = e
-			return
+			return nil, e
 		}
 
-		preStmt, values, e := preParser.ProcessPre(q.Query)
+		preStmt, values, e := preParser.ProcessPre(q.Query, rsql.SetAllowedKeys(keys))
 		if e != nil {
-			err = e
-			return
+			return nil, e
 		}
 
 		db.Where(preStmt, values...)
@@ -88,33 +145,25 @@ func (c *CRUDImpl) GetList(q BasicQuery, model, list interface{}) (total int64,
 
 	// 排序
 	if q.Order != "" {
-		orderKey := strings.Split(q.Order, " ")
-		switch len(orderKey) {
-		case 1:
-			columnName := parseColumnFunc(orderKey[0])
-			db.Order(columnName)
-		case 2:
-			columnName := parseColumnFunc(orderKey[0])
-			order := strings.ToLower(orderKey[1])
-			if order != "desc" && order != "asc" {
-				order = "asc"
-			}
-
-			db.Order(fmt.Sprintf("%s %s", columnName, order))
+		keys, e := cols.parseOrder(conn, q.Order)
+		if e != nil {
+			return nil, e
+		}
+		for _, k := range keys {
+			db.Order(k.order(false))
 		}
 	}
 
-	// 计数
-	db = db.Count(&total)
+	return db, nil
+}
 
-	// 分页
+// paginate 分页
+func paginate(db *gorm.DB, q BasicQuery) *gorm.DB {
 	if q.Limit > 0 && q.Offset >= 0 {
 		db.Limit(q.Limit).Offset(q.Offset)
 	}
 
-	err = db.Find(list).Error
-
-	return total, err
+	return db
 }
 
 // GetByID model must be a pointer
@@ -186,12 +235,23 @@ func (c *CRUDImpl) Create(model interface{}) error {
 }
 
 // UpdateWithMap model must be a pointer
+// 模型有 optlock 版本列时只在版本号未变化时更新，否则返回 ErrStaleObject
 func (c *CRUDImpl) UpdateWithMap(model interface{}, u map[string]interface{}) error {
 	if err := c.checkConn(); err != nil {
 		return err
 	}
 
-	return c.Conn.Model(model).Updates(u).Error
+	return updateWithMap(c.Conn, model, u)
+}
+
+// UpdateModel 保存模型的所有字段，model must be a pointer
+// 用于 GetByID 后修改再保存，有 optlock 版本列时同 UpdateWithMap
+func (c *CRUDImpl) UpdateModel(model interface{}) error {
+	if err := c.checkConn(); err != nil {
+		return err
+	}
+
+	return updateModel(c.Conn, model)
 }
 
 // Delete model must be a pointer
@@ -212,17 +272,16 @@ func KeywordGenerator(columnList []string, keyword string) func(db *gorm.DB) *go
 	var values []interface{}
 	stmt := "1 AND ("
 
-	length := len(columnList) - 1
 	for i := range columnList {
 		if columnList[i] == "id" {
 			continue
 		}
 
-		stmt += fmt.Sprintf("`%s` LIKE ? ", columnList[i])
-		values = append(values, fmt.Sprintf("%%%s%%", keyword))
-		if i != length {
+		if len(values) > 0 {
 			stmt += "OR "
 		}
+		stmt += fmt.Sprintf("`%s` LIKE ? ", columnList[i])
+		values = append(values, fmt.Sprintf("%%%s%%", keyword))
 	}
 
 	stmt += ") AND 1"
@@ -0,0 +1,181 @@
+/*
+@Date: 2022/3/14 10:20
+@Author: max.liu
+@File : tx
+*/
+
+package gormdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+const (
+	mysqlErrLockWaitTimeout = 1205
+	mysqlErrDeadlock        = 1213
+)
+
+type txCtxKey struct{}
+
+// ContextWithTx 把事务放入 ctx，Repo 和 Cli 使用该 ctx 时在事务中执行
+func ContextWithTx(ctx context.Context, tx *gorm.DB) context.Context {
+	return context.WithValue(ctx, txCtxKey{}, tx)
+}
+
+// TxFromContext 取出 ctx 中的事务，没有时返回 nil
+func TxFromContext(ctx context.Context) *gorm.DB {
+	if ctx == nil {
+		return nil
+	}
+
+	tx, _ := ctx.Value(txCtxKey{}).(*gorm.DB)
+	return tx
+}
+
+// Conn 优先返回 ctx 中的事务，否则返回带有链路追踪的主库连接
+func (d *DB) Conn(ctx context.Context) (*gorm.DB, error) {
+	if tx := TxFromContext(ctx); tx != nil {
+		// 新会话，不继承之前的查询条件
+		return tx.Session(&gorm.Session{NewDB: true}), nil
+	}
+
+	if d == nil || d.db == nil {
+		return nil, ErrClient
+	}
+
+	return d.Master(ctx), nil
+}
+
+type txOptions struct {
+	readOnly   bool
+	isolation  sql.IsolationLevel
+	maxRetries int
+	backoff    time.Duration
+}
+
+// TxOption 用于定制 WithTx 开启的事务，嵌套调用时忽略
+type TxOption func(*txOptions)
+
+// TxReadOnly 只读事务，配置了从库时在从库执行
+func TxReadOnly() TxOption {
+	return func(o *txOptions) { o.readOnly = true }
+}
+
+// TxIsolation 指定事务隔离级别，默认使用数据库的隔离级别
+func TxIsolation(level sql.IsolationLevel) TxOption {
+	return func(o *txOptions) { o.isolation = level }
+}
+
+// TxRetry 遇到死锁或锁等待超时时重新执行整个事务，最多重试 n 次，第 i 次重试前等待 i*backoff
+func TxRetry(n int, backoff time.Duration) TxOption {
+	return func(o *txOptions) {
+		o.maxRetries = n
+		o.backoff = backoff
+	}
+}
+
+// WithTx 使用单例 GetDB() 开启事务，见 DB.WithTx
+func WithTx(ctx context.Context, fn func(ctx context.Context) error, opts ...TxOption) error {
+	return GetDB().WithTx(ctx, fn, opts...)
+}
+
+// WithTx 在事务中执行 fn，传给 fn 的 ctx 中带有事务。fn 返回错误或 panic 时回滚，否则提交。
+// ctx 中已有事务时不再开启新事务，而是创建保存点，fn 失败时只回滚到该保存点。
+// 重试时 fn 会被再次调用，fn 中不应有事务之外的副作用。
+func (d *DB) WithTx(ctx context.Context, fn func(ctx context.Context) error, opts ...TxOption) (err error) {
+	if tx := TxFromContext(ctx); tx != nil {
+		return savepoint(ctx, tx, fn)
+	}
+
+	if d == nil || d.db == nil {
+		return ErrClient
+	}
+
+	o := txOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	for i := 0; ; i++ {
+		err = d.transaction(ctx, fn, &o)
+		if err == nil || i >= o.maxRetries || !IsRetryableTxError(err) {
+			return err
+		}
+
+		dbLog(ctx).Warnf("transaction retry %d/%d: %v", i+1, o.maxRetries, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(i+1) * o.backoff):
+		}
+	}
+}
+
+func (d *DB) transaction(ctx context.Context, fn func(ctx context.Context) error, o *txOptions) (err error) {
+	conn := d.Master(ctx)
+	if o.readOnly && len(d.replicas) > 0 {
+		// dbresolver 不会切换事务的连接，在开启事务前直接指定从库
+		conn = conn.Session(&gorm.Session{Context: conn.Statement.Context})
+		conn.Statement.ConnPool = d.replicas[rand.Intn(len(d.replicas))]
+	}
+
+	tx := conn.Begin(&sql.TxOptions{Isolation: o.isolation, ReadOnly: o.readOnly})
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	panicked := true
+	defer func() {
+		if panicked || err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = fn(ContextWithTx(ctx, tx)); err == nil {
+		err = tx.Commit().Error
+	}
+	panicked = false
+
+	return
+}
+
+var savepointSeq uint64
+
+func savepoint(ctx context.Context, tx *gorm.DB, fn func(ctx context.Context) error) (err error) {
+	tx = tx.Session(&gorm.Session{NewDB: true})
+	name := fmt.Sprintf("sp%d", atomic.AddUint64(&savepointSeq, 1))
+	if err = tx.SavePoint(name).Error; err != nil {
+		return
+	}
+
+	panicked := true
+	defer func() {
+		if panicked || err != nil {
+			tx.RollbackTo(name)
+		}
+	}()
+
+	err = fn(ctx)
+	panicked = false
+
+	return
+}
+
+// IsRetryableTxError 是否为死锁或锁等待超时，重新执行事务可能成功
+func IsRetryableTxError(err error) bool {
+	var e *mysql.MySQLError
+	if !errors.As(err, &e) {
+		return false
+	}
+
+	return e.Number == mysqlErrDeadlock || e.Number == mysqlErrLockWaitTimeout
+}
@@ -0,0 +1,127 @@
+/*
+@Date: 2022/3/14 10:20
+@Author: max.liu
+@File : tx_test
+*/
+
+package gormdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRetryableTxError(t *testing.T) {
+	deadlock := &mysql.MySQLError{Number: mysqlErrDeadlock, Message: "Deadlock found when trying to get lock"}
+
+	assert.True(t, IsRetryableTxError(deadlock))
+	assert.True(t, IsRetryableTxError(&mysql.MySQLError{Number: mysqlErrLockWaitTimeout}))
+	assert.True(t, IsRetryableTxError(fmt.Errorf("update order: %w", deadlock)))
+
+	assert.False(t, IsRetryableTxError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}))
+	assert.False(t, IsRetryableTxError(errors.New(deadlock.Error())))
+	assert.False(t, IsRetryableTxError(nil))
+}
+
+func TestWithTxRetry(t *testing.T) {
+	db := &DB{db: newFakeDB(t, &fakeConn{})}
+	deadlock := &mysql.MySQLError{Number: mysqlErrDeadlock}
+
+	var calls int
+	err := db.WithTx(context.Background(), func(ctx context.Context) error {
+		calls++
+		assert.NotNil(t, TxFromContext(ctx))
+		if calls < 3 {
+			return deadlock
+		}
+		return nil
+	}, TxRetry(2, time.Millisecond))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	// 超过重试次数或不可重试的错误直接返回
+	calls = 0
+	err = db.WithTx(context.Background(), func(ctx context.Context) error {
+		calls++
+		return deadlock
+	}, TxRetry(1, time.Millisecond))
+	assert.ErrorIs(t, err, deadlock)
+	assert.Equal(t, 2, calls)
+
+	calls = 0
+	failed := errors.New("failed")
+	err = db.WithTx(context.Background(), func(ctx context.Context) error {
+		calls++
+		return failed
+	}, TxRetry(3, time.Millisecond))
+	assert.ErrorIs(t, err, failed)
+	assert.Equal(t, 1, calls)
+}
+
+func TestWithTxSavepoint(t *testing.T) {
+	conn := &fakeConn{}
+	db := &DB{db: newFakeDB(t, conn)}
+	failed := errors.New("failed")
+
+	err := db.WithTx(context.Background(), func(ctx context.Context) error {
+		// 嵌套调用只回滚到保存点
+		assert.ErrorIs(t, db.WithTx(ctx, func(ctx context.Context) error { return failed }), failed)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	if assert.Len(t, conn.execs, 2) {
+		assert.True(t, strings.HasPrefix(conn.execs[0], "SAVEPOINT sp"), conn.execs[0])
+		assert.True(t, strings.HasPrefix(conn.execs[1], "ROLLBACK TO SAVEPOINT sp"), conn.execs[1])
+	}
+}
+
+func TestBuildMySQLClientFailed(t *testing.T) {
+	_default = nil
+	defer func() { _default = nil }()
+
+	c := DBConfig{WriteDBHost: "127.0.0.1", WriteDBPort: 1, WriteDB: "test", ReadDBHostList: []string{"127.0.0.1"}}
+	_, err := c.BuildMySQLClient(context.Background())
+	assert.Error(t, err)
+
+	// 失败后不会留下未初始化的单例
+	assert.Nil(t, _default)
+	_, err = c.BuildMySQLClient(context.Background())
+	assert.Error(t, err)
+}
+
+func TestWithTxCanceled(t *testing.T) {
+	conn := &fakeConn{}
+	db := &DB{db: newFakeDB(t, conn)}
+	deadlock := &mysql.MySQLError{Number: mysqlErrDeadlock}
+
+	// 事务绑定 ctx，已取消的请求不会开启事务
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var calls int
+	err := db.WithTx(ctx, func(ctx context.Context) error {
+		calls++
+		return nil
+	}, TxRetry(3, time.Millisecond))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, calls)
+
+	// 执行过程中取消后不再重试，语句也不会执行
+	ctx, cancel = context.WithCancel(context.Background())
+	err = db.WithTx(ctx, func(ctx context.Context) error {
+		calls++
+		cancel()
+		assert.ErrorIs(t, Cli(ctx).Exec("UPDATE orders SET status = 1").Error, context.Canceled)
+		return deadlock
+	}, TxRetry(3, time.Hour))
+	assert.ErrorIs(t, err, deadlock)
+	assert.Equal(t, 1, calls)
+	assert.Empty(t, conn.execs)
+}
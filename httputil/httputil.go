@@ -131,6 +131,7 @@ type sendOptions struct {
 	ctx           context.Context
 	spanCtx       context.Context
 	span          opentracing.Span
+	sign          *signOptions
 	// This is not a valid http option. It provides a way to override
 	// parts of the url. For example, url.Scheme can be changed from
 	// http to https.
@@ -293,25 +294,49 @@ func Send(method, rawurl string, options ...SendOption) (*http.Response, error)
 		o(opts)
 	}
 
+	var sign func()
+	if opts.sign != nil {
+		if sign, err = signRequest(method, opts); err != nil {
+			return nil, fmt.Errorf("sign request failed: %s", err.Error())
+		}
+	}
+
 	if opts.spanCtx != nil {
 		opts.span, _ = opentracing.StartSpanFromContext(opts.spanCtx, fmt.Sprintf("%s_%s://%s%s", method, u.Scheme, u.Host, u.Path))
 		defer opts.span.Finish()
 	}
 
-	req, err := newRequest(method, opts)
-	if err != nil {
-		return nil, err
-	}
-
 	if opts.span != nil {
 		ext.SpanKindRPCClient.Set(opts.span)
 		ext.HTTPUrl.Set(opts.span, rawurl)
 		ext.HTTPMethod.Set(opts.span, method)
-		_ = opts.span.Tracer().Inject(
-			opts.span.Context(),
-			opentracing.HTTPHeaders,
-			opentracing.HTTPHeadersCarrier(req.Header),
-		)
+	}
+
+	// 签名的请求每次发送前重新签名，避免重试时 nonce 重复被服务端拒绝
+	buildRequest := func() (*http.Request, error) {
+		if sign != nil {
+			sign()
+		}
+
+		req, err := newRequest(method, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		if opts.span != nil {
+			_ = opts.span.Tracer().Inject(
+				opts.span.Context(),
+				opentracing.HTTPHeaders,
+				opentracing.HTTPHeadersCarrier(req.Header),
+			)
+		}
+
+		return req, nil
+	}
+
+	req, err := buildRequest()
+	if err != nil {
+		return nil, err
 	}
 
 	client := http.Client{
@@ -329,7 +354,7 @@ func Send(method, rawurl string, options ...SendOption) (*http.Response, error)
 		if err != nil && req.URL.Scheme == schemeHTTPS && !opts.httpFallbackDisabled {
 			logger.Warnf("failed to send https request: %s. Retrying with http...", err)
 			var httpReq *http.Request
-			httpReq, err = newRequest(method, opts)
+			httpReq, err = buildRequest()
 			if err != nil {
 				if opts.span != nil {
 					opts.span.LogFields(
@@ -350,6 +375,11 @@ func Send(method, rawurl string, options ...SendOption) (*http.Response, error)
 				break // Backoff timed out.
 			}
 			time.Sleep(d)
+			if sign != nil {
+				if req, err = buildRequest(); err != nil {
+					return nil, err
+				}
+			}
 			continue
 		}
 		break
@@ -441,7 +471,8 @@ func PollAccepted(url string, b backoff.BackOff, options ...SendOption) (*http.R
 func SendWithCtx(ctx context.Context, method, url string, sendOptions ...SendOption) (respBytes []byte, err error) {
 	spanCtx, err := gadget.ExtractTraceSpan(ctx)
 	if err == nil {
-		sendOptions = append(sendOptions, SendTraceCTX(spanCtx), SendContext(ctx))
+		// spanCtx 上带有 middleware.Timeout 设置的截止时间，gin.Context 本身不会被取消
+		sendOptions = append(sendOptions, SendTraceCTX(spanCtx), SendContext(spanCtx))
 	} else {
 		sendOptions = append(sendOptions, SendContext(ctx))
 	}
@@ -70,6 +70,7 @@ func (c *Config) BuildKafka(ctx context.Context) (*CliCfg, error) {
 
 	kCli.kafkaCfg = kafkaConfig
 	_defaultKafka = kCli
+	logger.RegisterLogProducer(&logProducer{cli: kCli})
 
 	return kCli, nil
 }
@@ -8,11 +8,18 @@ package kafka
 
 import (
 	"strings"
+	"sync"
 
+	"github.com/Shopify/sarama"
 	"github.com/maxliu9403/common/logger"
 )
 
-const LogDebug = "debug"
+const (
+	LogDebug = "debug"
+
+	// logModule sarama 日志使用的模块名，可通过 logger.SetLevel 单独调整级别，这些日志不会发送到 logger 的 kafka 输出
+	logModule = logger.KafkaModule
+)
 
 type kafkaLog struct {
 	Level string
@@ -26,24 +33,60 @@ func newKafkaLog(level string) *kafkaLog {
 
 func (d *kafkaLog) Print(v ...interface{}) {
 	if d.Level == LogDebug {
-		logger.Default().Debug(v...)
+		logger.NamedSkip(logModule).Debug(v...)
 	} else {
-		logger.Default().Info(v...)
+		logger.NamedSkip(logModule).Info(v...)
 	}
 }
 
 func (d *kafkaLog) Printf(format string, v ...interface{}) {
 	if d.Level == LogDebug {
-		logger.Default().Debugf(strings.TrimSpace(format), v...)
+		logger.NamedSkip(logModule).Debugf(strings.TrimSpace(format), v...)
 	} else {
-		logger.Default().Infof(strings.TrimSpace(format), v...)
+		logger.NamedSkip(logModule).Infof(strings.TrimSpace(format), v...)
 	}
 }
 
 func (d *kafkaLog) Println(v ...interface{}) {
 	if d.Level == LogDebug {
-		logger.Default().Debug(v...)
+		logger.NamedSkip(logModule).Debug(v...)
 	} else {
-		logger.Default().Info(v...)
+		logger.NamedSkip(logModule).Info(v...)
+	}
+}
+
+// logProducer 实现 logger.LogProducer，使用单独的同步生产者发送日志，首次发送时连接
+type logProducer struct {
+	cli      *CliCfg
+	lock     sync.Mutex
+	producer sarama.SyncProducer
+}
+
+func (p *logProducer) SendLogs(topic, key string, values [][]byte) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.producer == nil {
+		// 异步生产者会修改共用的配置，同步生产者需要 Return.Successes
+		conf := *p.cli.kafkaCfg
+		conf.Producer.Return.Successes = true
+		conf.Producer.Return.Errors = true
+
+		producer, err := sarama.NewSyncProducer(p.cli.addr, &conf)
+		if err != nil {
+			return err
+		}
+		p.producer = producer
 	}
+
+	msgs := make([]*sarama.ProducerMessage, len(values))
+	for i, v := range values {
+		msgs[i] = &sarama.ProducerMessage{
+			Topic: topic,
+			Key:   sarama.StringEncoder(key),
+			Value: sarama.ByteEncoder(v),
+		}
+	}
+
+	return p.producer.SendMessages(msgs)
 }
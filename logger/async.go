@@ -0,0 +1,311 @@
+package logger
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap/zapcore"
+)
+
+// OverflowPolicy 异步缓冲满时的处理方式
+type OverflowPolicy string
+
+const (
+	OverflowBlock      OverflowPolicy = "block"       // 等待缓冲有空位，不丢日志
+	OverflowDropNewest OverflowPolicy = "drop_newest" // 丢弃新写入的日志
+	OverflowDropLow    OverflowPolicy = "drop_low"    // 优先丢弃缓冲中最旧的 debug 和 info 日志
+)
+
+func (p OverflowPolicy) IsValid() bool {
+	return p == "" || p == OverflowBlock || p == OverflowDropNewest || p == OverflowDropLow
+}
+
+type AsyncConfig struct {
+	Enable        bool           `yaml:"enable"`
+	BufferSize    int            `yaml:"buffer_size"`    // 每个输出缓冲的日志条数，默认 8192
+	BatchSize     int            `yaml:"batch_size"`     // 缓冲达到这么多条时立即写出，默认 256
+	FlushInterval int            `yaml:"flush_interval"` // 单位毫秒，默认 1000
+	Overflow      OverflowPolicy `yaml:"overflow"`       // 默认 block
+}
+
+func (c AsyncConfig) withDefaults() AsyncConfig {
+	if c.BufferSize <= 0 {
+		c.BufferSize = 8192
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 256
+	}
+	if c.BatchSize > c.BufferSize {
+		c.BatchSize = c.BufferSize
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = 1000
+	}
+	if c.Overflow == "" {
+		c.Overflow = OverflowBlock
+	}
+
+	return c
+}
+
+var (
+	asyncDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "log_async_dropped_total",
+		Help: "Total number of log entries dropped by the async log writer.",
+	}, []string{"output", "level"})
+	asyncQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "log_async_queue_depth",
+		Help: "Number of log entries waiting in the async log writer.",
+	}, []string{"output"})
+)
+
+func init() {
+	prometheus.MustRegister(asyncDropped, asyncQueueDepth)
+}
+
+type asyncEntry struct {
+	level zapcore.Level
+	data  []byte
+}
+
+// asyncWriter 将编码后的日志放入环形缓冲，由后台协程按条数或时间批量写出
+type asyncWriter struct {
+	ws   zapcore.WriteSyncer
+	name string
+	conf AsyncConfig
+
+	lock     sync.Mutex
+	notFull  *sync.Cond
+	drained  *sync.Cond
+	ring     []asyncEntry
+	head     int
+	size     int
+	inflight bool
+	closed   bool
+
+	wake   chan struct{}
+	stop   chan struct{}
+	exited chan struct{}
+	batch  []asyncEntry
+	buf    []byte
+	depth  prometheus.Gauge
+}
+
+func newAsyncWriter(name string, ws zapcore.WriteSyncer, conf AsyncConfig) *asyncWriter {
+	conf = conf.withDefaults()
+	w := &asyncWriter{
+		ws:     ws,
+		name:   name,
+		conf:   conf,
+		ring:   make([]asyncEntry, conf.BufferSize),
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		exited: make(chan struct{}),
+		depth:  asyncQueueDepth.WithLabelValues(name),
+	}
+	w.notFull = sync.NewCond(&w.lock)
+	w.drained = sync.NewCond(&w.lock)
+
+	go w.run()
+	return w
+}
+
+// push 复制 p 后放入缓冲，关闭后直接同步写出
+func (w *asyncWriter) push(level zapcore.Level, p []byte) {
+	data := append([]byte(nil), p...)
+
+	w.lock.Lock()
+	for !w.closed && w.size == len(w.ring) {
+		if w.conf.Overflow == OverflowBlock {
+			w.signal()
+			w.notFull.Wait()
+			continue
+		}
+		if w.conf.Overflow == OverflowDropLow && level > zapcore.InfoLevel && w.evictLowLocked() {
+			break
+		}
+
+		w.lock.Unlock()
+		asyncDropped.WithLabelValues(w.name, level.String()).Inc()
+		return
+	}
+	if w.closed {
+		w.lock.Unlock()
+		_, _ = w.ws.Write(data)
+		return
+	}
+
+	w.ring[(w.head+w.size)%len(w.ring)] = asyncEntry{level: level, data: data}
+	w.size++
+	w.depth.Set(float64(w.size))
+	if w.size >= w.conf.BatchSize {
+		w.signal()
+	}
+	w.lock.Unlock()
+}
+
+// evictLowLocked 移除缓冲中最旧的 debug 或 info 日志，没有时返回 false
+func (w *asyncWriter) evictLowLocked() bool {
+	n := len(w.ring)
+	for i := 0; i < w.size; i++ {
+		e := w.ring[(w.head+i)%n]
+		if e.level > zapcore.InfoLevel {
+			continue
+		}
+
+		for j := i; j < w.size-1; j++ {
+			w.ring[(w.head+j)%n] = w.ring[(w.head+j+1)%n]
+		}
+		w.size--
+		w.ring[(w.head+w.size)%n] = asyncEntry{}
+		asyncDropped.WithLabelValues(w.name, e.level.String()).Inc()
+		return true
+	}
+
+	return false
+}
+
+func (w *asyncWriter) signal() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *asyncWriter) run() {
+	defer close(w.exited)
+
+	ticker := time.NewTicker(time.Duration(w.conf.FlushInterval) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.wake:
+		case <-ticker.C:
+		case <-w.stop:
+			w.writeBatch()
+			return
+		}
+		w.writeBatch()
+	}
+}
+
+// writeBatch 取出缓冲中的全部日志，合并后一次写出
+func (w *asyncWriter) writeBatch() {
+	w.lock.Lock()
+	if w.size == 0 {
+		w.lock.Unlock()
+		return
+	}
+
+	n := len(w.ring)
+	w.batch = w.batch[:0]
+	for i := 0; i < w.size; i++ {
+		idx := (w.head + i) % n
+		w.batch = append(w.batch, w.ring[idx])
+		w.ring[idx] = asyncEntry{}
+	}
+	w.head, w.size = 0, 0
+	w.inflight = true
+	w.depth.Set(0)
+	w.notFull.Broadcast()
+	w.lock.Unlock()
+
+	w.buf = w.buf[:0]
+	for _, e := range w.batch {
+		w.buf = append(w.buf, e.data...)
+	}
+	_, _ = w.ws.Write(w.buf)
+
+	w.lock.Lock()
+	w.inflight = false
+	w.drained.Broadcast()
+	w.lock.Unlock()
+}
+
+// Write 不带级别的写入按 info 处理
+func (w *asyncWriter) Write(p []byte) (int, error) {
+	w.push(zapcore.InfoLevel, p)
+	return len(p), nil
+}
+
+func (w *asyncWriter) Sync() error {
+	return w.Flush()
+}
+
+// Flush 等待缓冲中的日志全部写出后刷新到存储
+func (w *asyncWriter) Flush() error {
+	w.lock.Lock()
+	for !w.closed && (w.size > 0 || w.inflight) {
+		w.signal()
+		w.drained.Wait()
+	}
+	w.lock.Unlock()
+
+	return w.ws.Sync()
+}
+
+// Close 写出缓冲中的日志并停止后台协程，之后的日志同步写出
+func (w *asyncWriter) Close() error {
+	w.lock.Lock()
+	if w.closed {
+		w.lock.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.notFull.Broadcast()
+	w.drained.Broadcast()
+	w.lock.Unlock()
+
+	close(w.stop)
+	<-w.exited
+
+	return w.ws.Sync()
+}
+
+// asyncCore 在调用方协程编码，由 asyncWriter 异步写出
+type asyncCore struct {
+	zapcore.LevelEnabler
+	enc zapcore.Encoder
+	w   *asyncWriter
+}
+
+func (c *asyncCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.enc = c.enc.Clone()
+	for i := range fields {
+		fields[i].AddTo(clone.enc)
+	}
+
+	return &clone
+}
+
+func (c *asyncCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+
+	return ce
+}
+
+func (c *asyncCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+
+	c.w.push(ent.Level, buf.Bytes())
+	buf.Free()
+
+	// 与 zap 一致，panic 和 fatal 之前确保日志已写出
+	if ent.Level > zapcore.ErrorLevel {
+		return c.w.Flush()
+	}
+
+	return nil
+}
+
+func (c *asyncCore) Sync() error {
+	return c.w.Flush()
+}
@@ -0,0 +1,134 @@
+package logger
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// gateWriter 在 gate 关闭前阻塞写入
+type gateWriter struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+	gate chan struct{}
+}
+
+func (w *gateWriter) Write(p []byte) (int, error) {
+	<-w.gate
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *gateWriter) Sync() error { return nil }
+
+func (w *gateWriter) String() string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.buf.String()
+}
+
+func droppedCount(name, level string) float64 {
+	m := &dto.Metric{}
+	_ = asyncDropped.WithLabelValues(name, level).Write(m)
+	return m.GetCounter().GetValue()
+}
+
+func TestAsyncWriterFlush(t *testing.T) {
+	ws := &gateWriter{gate: make(chan struct{})}
+	close(ws.gate)
+	w := newAsyncWriter("flush", ws, AsyncConfig{BatchSize: 10, FlushInterval: 60000})
+
+	encoderConf := zap.NewProductionEncoderConfig()
+	encoderConf.TimeKey = ""
+	l := zap.New(&asyncCore{LevelEnabler: zapcore.DebugLevel, enc: zapcore.NewConsoleEncoder(encoderConf), w: w})
+	l.Info("first")
+	l.Info("second")
+	assert.Empty(t, ws.String())
+
+	assert.NoError(t, l.Sync())
+	assert.Equal(t, "info\tfirst\ninfo\tsecond\n", ws.String())
+
+	// 关闭后同步写出
+	assert.NoError(t, w.Close())
+	l.Warn("third")
+	assert.Equal(t, "info\tfirst\ninfo\tsecond\nwarn\tthird\n", ws.String())
+}
+
+func TestAsyncWriterOverflow(t *testing.T) {
+	cases := []struct {
+		policy  OverflowPolicy
+		output  string
+		dropped map[string]float64
+	}{
+		{OverflowDropNewest, "a\nb\nc\n", map[string]float64{"error": 1, "info": 1}},
+		{OverflowDropLow, "a\nc\nd\n", map[string]float64{"info": 2}},
+	}
+
+	for _, c := range cases {
+		name := "overflow_" + string(c.policy)
+		before := make(map[string]float64)
+		for level := range c.dropped {
+			before[level] = droppedCount(name, level)
+		}
+		ws := &gateWriter{gate: make(chan struct{})}
+		w := newAsyncWriter(name, ws, AsyncConfig{BufferSize: 2, BatchSize: 1, FlushInterval: 60000, Overflow: c.policy})
+
+		// a 被后台协程取出后阻塞在写入，缓冲中只剩 b 和 c
+		w.push(zapcore.InfoLevel, []byte("a\n"))
+		assert.Eventually(t, func() bool {
+			w.lock.Lock()
+			defer w.lock.Unlock()
+			return w.inflight
+		}, time.Second, time.Millisecond)
+		w.push(zapcore.InfoLevel, []byte("b\n"))
+		w.push(zapcore.WarnLevel, []byte("c\n"))
+		w.push(zapcore.ErrorLevel, []byte("d\n"))
+		w.push(zapcore.InfoLevel, []byte("e\n"))
+
+		close(ws.gate)
+		assert.NoError(t, w.Flush())
+		assert.Equal(t, c.output, ws.String(), c.policy)
+		for level, n := range c.dropped {
+			assert.Equal(t, n, droppedCount(name, level)-before[level], c.policy)
+		}
+		assert.NoError(t, w.Close())
+	}
+}
+
+func TestAsyncWriterBlock(t *testing.T) {
+	ws := &gateWriter{gate: make(chan struct{})}
+	w := newAsyncWriter("block", ws, AsyncConfig{BufferSize: 1, BatchSize: 1, FlushInterval: 60000})
+	defer w.Close()
+
+	w.push(zapcore.InfoLevel, []byte("a\n"))
+	assert.Eventually(t, func() bool {
+		w.lock.Lock()
+		defer w.lock.Unlock()
+		return w.inflight
+	}, time.Second, time.Millisecond)
+	w.push(zapcore.InfoLevel, []byte("b\n"))
+
+	done := make(chan struct{})
+	go func() {
+		w.push(zapcore.InfoLevel, []byte("c\n"))
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("push should block when the buffer is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(ws.gate)
+	<-done
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, "a\nb\nc\n", ws.String())
+}
@@ -9,7 +9,6 @@ package logger
 import (
 	"fmt"
 
-	"go.uber.org/zap"
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
@@ -18,28 +17,36 @@ var (
 )
 
 type Config struct {
-	Level       LogLevel        `yaml:"level" env:"LogLevel" env-default:"info" env-description:"log level"`
-	Encoding    ZapConfEncoding `yaml:"encoding" env:"LogEncoding" env-default:"console" env-description:"log encoding"`
-	Development bool            `yaml:"development"`
-	EnableTrace bool            `yaml:"enable_trace"`
-	LogPath     string          `yaml:"log_path" env:"LogPath" env-description:"which path the log file should be"`
-	LogName     string          `yaml:"log_name" env:"LogFileName" env-description:"which file name the log file should be"`
-	MaxSize     int             `yaml:"max_size" env:"LogMaxSize" env-description:"max size of rotating"`
-	MaxAge      int             `yaml:"max_age" env:"LogMaxAge" env-description:"max age of rotating"`
-	LocalTime   bool            `yaml:"localtime"`
-	Compress    bool            `yaml:"compress" env:"LogCompress" env-description:"compress old log files or not"`
+	Level        LogLevel            `yaml:"level" env:"LogLevel" env-default:"info" env-description:"log level"`
+	Encoding     ZapConfEncoding     `yaml:"encoding" env:"LogEncoding" env-default:"console" env-description:"log encoding"`
+	Development  bool                `yaml:"development"`
+	EnableTrace  bool                `yaml:"enable_trace"`
+	LogPath      string              `yaml:"log_path" env:"LogPath" env-description:"which path the log file should be"`
+	LogName      string              `yaml:"log_name" env:"LogFileName" env-description:"which file name the log file should be"`
+	MaxSize      int                 `yaml:"max_size" env:"LogMaxSize" env-description:"max size of rotating"`
+	MaxAge       int                 `yaml:"max_age" env:"LogMaxAge" env-description:"max age of rotating"`
+	MaxBackups   int                 `yaml:"max_backups" env:"LogMaxBackups" env-description:"max number of old log files to retain"`
+	LocalTime    bool                `yaml:"localtime"`
+	Compress     bool                `yaml:"compress" env:"LogCompress" env-description:"compress old log files or not"`
+	RotatePeriod RotatePeriod        `yaml:"rotate_period" env:"LogRotatePeriod" env-description:"rotate log files hourly or daily"`          // 按小时或天切割，文件名带有日期，如 app-20211110.log
+	MaxTotalSize int                 `yaml:"max_total_size" env:"LogMaxTotalSize" env-description:"max total size in megabytes of log files"` // 超出后从最旧的文件开始删除
+	Symlink      bool                `yaml:"symlink"`                                                                                         // 按时间切割时，将 <log_name>.log 软链接到当前文件
+	Modules      map[string]LogLevel `yaml:"modules"`                                                                                         // 单独设置模块的日志级别，如 kafka: debug
+	Mask         MaskConfig          `yaml:"mask"`                                                                                            // 对日志中的手机号、身份证号等敏感信息脱敏
+	Sampling     SamplingConfig      `yaml:"sampling"`                                                                                        // 日志采样和重复日志合并
+	Outputs      []OutputConfig      `yaml:"outputs"`                                                                                         // 按级别写入不同的目标，配置后不再使用默认的 stderr 和 log_path 输出
+	Async        AsyncConfig         `yaml:"async"`                                                                                           // 异步批量写出，syslog 以外的输出生效，kafka 输出总是异步发送
 }
 
 type Options struct {
 	Config
-	zapConfig zap.Config
 }
 
 func (o *Options) CompareOptions() string {
 	return fmt.Sprintf("level is %s, encoding is %s, log path is %s,", o.Level, o.Encoding.String(), o.LogPath)
 }
 
-func initLumberjackConf(o *Options) *lumberjack.Logger {
+func (o *Options) setRotateDefaults() {
 	if o.MaxSize == 0 {
 		o.MaxSize = 200
 		o.LocalTime = true
@@ -48,11 +55,16 @@ func initLumberjackConf(o *Options) *lumberjack.Logger {
 	if o.MaxAge == 0 {
 		o.MaxAge = 28
 	}
+}
+
+func initLumberjackConf(o *Options) *lumberjack.Logger {
+	o.setRotateDefaults()
 
 	return &lumberjack.Logger{
-		MaxSize:   o.MaxSize, // megabytes
-		MaxAge:    o.MaxAge,  // days
-		LocalTime: o.LocalTime,
-		Compress:  o.Compress,
+		MaxSize:    o.MaxSize, // megabytes
+		MaxAge:     o.MaxAge,  // days
+		MaxBackups: o.MaxBackups,
+		LocalTime:  o.LocalTime,
+		Compress:   o.Compress,
 	}
 }
@@ -0,0 +1,109 @@
+package logger
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maxliu9403/common/gadget"
+	"go.uber.org/zap"
+)
+
+// LogFieldsKey 日志字段在 context 和 gin.Context 的 Keys 中保存的 key，使用字符串以兼容 gin.Context.Value
+const LogFieldsKey = "log_fields"
+
+// WithContext 把字段附加到 ctx 上，之后通过 FromContext 和 *WithTrace 输出的日志都会带上这些字段，同名字段以后设置的为准。
+// ctx 为 *gin.Context 时字段保存在 c.Keys 中，同时写入 c.Request 的 context 和已有的 span context，返回的仍是该 *gin.Context。
+func WithContext(ctx context.Context, keysAndValues ...interface{}) context.Context {
+	fields := mergeFields(ctxFields(ctx), keysAndValues)
+
+	c, ok := ctx.(*gin.Context)
+	if !ok {
+		return context.WithValue(ctx, LogFieldsKey, fields) //nolint:staticcheck
+	}
+
+	c.Set(LogFieldsKey, fields)
+	if c.Request != nil {
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), LogFieldsKey, fields)) //nolint:staticcheck
+	}
+	if spanCtx, ok := c.Value(gadget.SpanCtxKey).(context.Context); ok {
+		c.Set(gadget.SpanCtxKey, context.WithValue(spanCtx, LogFieldsKey, fields)) //nolint:staticcheck
+	}
+
+	return c
+}
+
+// FromContext 返回带有 ctx 中的 span 信息和 WithContext 字段的 logger，用于直接调用，不跳过调用栈
+func FromContext(ctx context.Context) *zap.SugaredLogger {
+	if fields := ContextFields(ctx); len(fields) > 0 {
+		return DefaultLog.direct.With(fields...)
+	}
+
+	return DefaultLog.direct
+}
+
+// ContextFields 返回 ctx 中的 trace_id、span_id 和 WithContext 附加的字段，格式与 With 的参数一致
+func ContextFields(ctx context.Context) []interface{} {
+	fields := ctxFields(ctx)
+	spanData := extractSpan(ctx)
+	if len(spanData) == 0 {
+		return fields
+	}
+
+	return append(spanData, fields...)
+}
+
+func ctxFields(ctx context.Context) []interface{} {
+	if ctx == nil {
+		return nil
+	}
+
+	fields, _ := ctx.Value(LogFieldsKey).([]interface{})
+	return fields
+}
+
+// withTrace 供包内的 *WithTrace 函数使用，与 Default 一样跳过一层调用栈
+func withTrace(ctx context.Context) *zap.SugaredLogger {
+	if fields := ContextFields(ctx); len(fields) > 0 {
+		return Default().With(fields...)
+	}
+
+	return Default()
+}
+
+// mergeFields 合并键值对，统一转换为 zap.Field，同名的字段以 added 为准，返回新的切片
+func mergeFields(origin, added []interface{}) []interface{} {
+	res := make([]interface{}, 0, len(origin)+len(added))
+	index := make(map[string]int)
+
+	appendPairs := func(pairs []interface{}) {
+		for i := 0; i < len(pairs); i++ {
+			var field zap.Field
+			switch v := pairs[i].(type) {
+			case zap.Field:
+				field = v
+			case string:
+				if i+1 >= len(pairs) {
+					res = append(res, v)
+					continue
+				}
+				field = zap.Any(v, pairs[i+1])
+				i++
+			default:
+				// 交给 zap 报告无效的 key
+				res = append(res, v)
+				continue
+			}
+
+			if pos, ok := index[field.Key]; ok {
+				res[pos] = field
+				continue
+			}
+			index[field.Key] = len(res)
+			res = append(res, field)
+		}
+	}
+	appendPairs(origin)
+	appendPairs(added)
+
+	return res
+}
@@ -0,0 +1,47 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maxliu9403/common/gadget"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestWithContext(t *testing.T) {
+	buf := &bytes.Buffer{}
+	encoderConf := zap.NewProductionEncoderConfig()
+	encoderConf.TimeKey = ""
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConf), zapcore.AddSync(buf), zapcore.DebugLevel)
+
+	origin := DefaultLog.direct
+	DefaultLog.direct = zap.New(core).Sugar()
+	defer func() { DefaultLog.direct = origin }()
+
+	ctx := WithContext(context.Background(), "tenant", "t1", "user", "u1")
+	ctx = WithContext(ctx, "user", "u2", zap.Int64("order_id", 42))
+	FromContext(ctx).Infow("created")
+	assert.JSONEq(t, `{"level":"info","msg":"created","tenant":"t1","user":"u2","order_id":42}`, buf.String())
+
+	// gin.Context 中设置的字段对 request context 和 span context 同样可见
+	buf.Reset()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	c.Set(gadget.SpanCtxKey, context.Background())
+	WithContext(c, "tenant", "t2")
+
+	spanCtx, err := gadget.ExtractTraceSpan(c)
+	assert.NoError(t, err)
+	assert.Equal(t, ContextFields(c), ContextFields(spanCtx))
+	assert.Equal(t, ContextFields(c), ContextFields(c.Request.Context()))
+
+	FromContext(spanCtx).Info("done")
+	assert.JSONEq(t, `{"level":"info","msg":"done","tenant":"t2"}`, buf.String())
+
+	assert.Equal(t, DefaultLog.direct, FromContext(context.Background()))
+}
@@ -0,0 +1,120 @@
+package logger
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// KafkaModule kafka 包日志使用的模块名，这些日志不会发送到 kafka 输出，避免发送过程中的日志再次触发发送
+const KafkaModule = "kafka"
+
+// kafka 发送失败后，这段时间内的日志直接写入本地文件
+const kafkaRetryInterval = 30 * time.Second
+
+// LogProducer 批量发送日志到 kafka，由 kafka 包在 BuildKafka 时注册，logger 不直接依赖 kafka 包
+type LogProducer interface {
+	SendLogs(topic, key string, values [][]byte) error
+}
+
+type producerHolder struct {
+	LogProducer
+}
+
+var currentProducer atomic.Value
+
+// RegisterLogProducer 注册 kafka 输出使用的生产者，注册之前的日志写入本地文件
+func RegisterLogProducer(p LogProducer) {
+	currentProducer.Store(producerHolder{p})
+}
+
+func logProducer() LogProducer {
+	h, _ := currentProducer.Load().(producerHolder)
+	return h.LogProducer
+}
+
+// kafkaWriter 每行一条消息发送到 kafka，失败时写入本地文件
+type kafkaWriter struct {
+	topic    string
+	key      string
+	fallback zapcore.WriteSyncer
+
+	lock    sync.Mutex
+	retryAt time.Time
+	values  [][]byte
+}
+
+func (w *kafkaWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if producer := logProducer(); producer != nil && !time.Now().Before(w.retryAt) {
+		w.values = w.values[:0]
+		for _, line := range bytes.Split(bytes.TrimRight(p, "\n"), []byte("\n")) {
+			w.values = append(w.values, line)
+		}
+		if err := producer.SendLogs(w.topic, w.key, w.values); err == nil {
+			return len(p), nil
+		}
+
+		w.retryAt = time.Now().Add(kafkaRetryInterval)
+	}
+
+	return w.fallback.Write(p)
+}
+
+func (w *kafkaWriter) Sync() error {
+	return w.fallback.Sync()
+}
+
+// kafkaCore 忽略 kafka 包自身的日志
+type kafkaCore struct {
+	zapcore.Core
+}
+
+func (c *kafkaCore) With(fields []zapcore.Field) zapcore.Core {
+	return &kafkaCore{Core: c.Core.With(fields)}
+}
+
+func (c *kafkaCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.LoggerName == KafkaModule || strings.HasPrefix(ent.LoggerName, KafkaModule+".") {
+		return ce
+	}
+
+	return c.Core.Check(ent, ce)
+}
+
+// newKafkaCore 日志以 JSON 编码并带有服务名和主机名，消息 key 为 <服务名>/<主机名>，总是异步批量发送
+func newKafkaCore(d *DemoLog, o *Options, out OutputConfig, encoderConf zapcore.EncoderConfig, masker *Masker, level zapcore.LevelEnabler) (zapcore.Core, []io.Closer) {
+	service := out.tag()
+	host, _ := os.Hostname()
+
+	var enc zapcore.Encoder = zapcore.NewJSONEncoder(encoderConf)
+	if masker != nil {
+		enc = newMaskEncoder(enc, masker)
+	}
+	enc.AddString("service", service)
+	enc.AddString("host", host)
+
+	name := out.FileName
+	if name == "" {
+		name = d.logName() + "-kafka"
+	}
+	fallback, release := acquireRotateSink(filepath.Join(d.logDir, name+".log"), o)
+	kw := &kafkaWriter{
+		topic:    out.Topic,
+		key:      service + "/" + host,
+		fallback: fallback,
+	}
+	w := newAsyncWriter("kafka:"+out.Topic, kw, o.Async)
+
+	// 先关闭异步缓冲，再释放本地文件
+	return &kafkaCore{Core: &asyncCore{LevelEnabler: level, enc: enc, w: w}}, []io.Closer{release, w}
+}
@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type fakeProducer struct {
+	lock   sync.Mutex
+	err    error
+	keys   []string
+	values []string
+}
+
+func (p *fakeProducer) SendLogs(topic, key string, values [][]byte) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+	for _, v := range values {
+		p.keys = append(p.keys, topic+":"+key)
+		p.values = append(p.values, string(v))
+	}
+
+	return nil
+}
+
+func TestKafkaOutput(t *testing.T) {
+	dir := t.TempDir()
+	defer RegisterLogProducer(nil)
+
+	encoderConf := zap.NewProductionEncoderConfig()
+	encoderConf.TimeKey = ""
+	out := OutputConfig{Target: OutputKafka, Topic: "logs", Tag: "demo"}
+	core, closers := newKafkaCore(&DemoLog{logDir: dir}, &Options{}, out, encoderConf, nil, zapcore.DebugLevel)
+	defer func() {
+		for i := len(closers) - 1; i >= 0; i-- {
+			_ = closers[i].Close()
+		}
+	}()
+	l := zap.New(core)
+	host, _ := os.Hostname()
+
+	// 未注册生产者时写入本地文件
+	l.Info("before register")
+	assert.NoError(t, l.Sync())
+	data, err := os.ReadFile(filepath.Join(dir, "app-kafka.log"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"msg":"before register"`)
+
+	p := &fakeProducer{}
+	RegisterLogProducer(p)
+	l.Info("first", zap.Int("n", 1))
+	l.Named(KafkaModule).Info("from sarama")
+	l.Named(KafkaModule + ".producer").Info("from producer")
+	l.Warn("second")
+	assert.NoError(t, l.Sync())
+
+	assert.Equal(t, []string{"logs:demo/" + host, "logs:demo/" + host}, p.keys)
+	if assert.Len(t, p.values, 2) {
+		assert.JSONEq(t, `{"level":"info","msg":"first","service":"demo","host":"`+host+`","n":1}`, p.values[0])
+		assert.JSONEq(t, `{"level":"warn","msg":"second","service":"demo","host":"`+host+`"}`, p.values[1])
+	}
+
+	// 发送失败后暂停发送，直接写入本地文件
+	p.err = errors.New("kafka: client has run out of available brokers")
+	l.Error("unreachable")
+	assert.NoError(t, l.Sync())
+	p.err = nil
+	l.Error("still fallback")
+	assert.NoError(t, l.Sync())
+
+	assert.Len(t, p.values, 2)
+	data, err = os.ReadFile(filepath.Join(dir, "app-kafka.log"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(string(data), "\n"))
+	assert.Contains(t, string(data), `"msg":"still fallback"`)
+}
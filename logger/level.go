@@ -1,9 +1,11 @@
 package logger
 
 import (
+	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap/zapcore"
 )
 
 func Wrap(router *gin.Engine) {
@@ -18,6 +20,9 @@ func WrapGroup(router *gin.RouterGroup) {
 	}{
 		{"GET", "/log/level/", GetHandler()},
 		{"PUT", "/log/level/update", PutHandler()},
+		{"GET", "/log/level/modules", ModulesHandler()},
+		{"PUT", "/log/level/modules/:name", PutModuleHandler()},
+		{"DELETE", "/log/level/modules/:name", ResetModuleHandler()},
 	}
 
 	basePath := strings.TrimSuffix(router.BasePath(), "/")
@@ -46,3 +51,39 @@ func PutHandler() gin.HandlerFunc {
 		DefaultLog.config.Level.ServeHTTP(c.Writer, c.Request)
 	}
 }
+
+// ModulesHandler 列出全局级别和各模块的级别
+func ModulesHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"level":   DefaultLog.config.Level.String(),
+			"modules": Levels(),
+		})
+	}
+}
+
+// PutModuleHandler 单独设置模块的级别，请求体与 /log/level/update 相同，如 {"level":"debug"}
+func PutModuleHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Level *zapcore.Level `json:"level"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || req.Level == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "must specify a valid logging level"})
+			return
+		}
+
+		name := c.Param("name")
+		SetLevel(name, LogLevel(req.Level.String()))
+		c.JSON(http.StatusOK, ModuleLevel{Name: name, Level: req.Level.String(), Override: true})
+	}
+}
+
+// ResetModuleHandler 恢复模块跟随全局级别
+func ResetModuleHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		ResetLevel(name)
+		c.JSON(http.StatusOK, ModuleLevel{Name: name, Level: DefaultLog.config.Level.String()})
+	}
+}
@@ -21,9 +21,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"net/url"
+	"io"
 	"os"
 	"path"
+	"time"
 
 	"github.com/maxliu9403/common/gadget"
 	"github.com/opentracing/opentracing-go"
@@ -38,84 +39,174 @@ var (
 
 type DemoLog struct {
 	*zap.SugaredLogger
+	base        *zap.Logger        // 以最低级别构建，不含级别过滤和调用栈跳过
+	direct      *zap.SugaredLogger // 按全局级别过滤，不跳过调用栈，供 FromContext 和直接调用 DemoLog 的方法使用
+	skip        *zap.SugaredLogger // 跳过一层调用栈，供包级别函数使用
 	config      *zap.Config
 	logDir      string
 	logBaseName string
+	modules     map[string]LogLevel // SetDefault 时设置的模块级别
+	closers     []io.Closer         // 异步缓冲和网络连接，Close 时关闭
+	owned       bool                // 由 ConfigureLogger 创建，被替换时关闭
 }
 
 // configure a default logger
 func init() {
 	defaultConfig = &Options{}
-	defaultConfig.zapConfig = zap.NewProductionConfig()
-	defaultConfig.zapConfig.Encoding = ZapEncodeConsole.String()
-	defaultConfig.zapConfig.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-	defaultConfig.zapConfig.DisableStacktrace = true
-
-	DefaultLog = &DemoLog{
-		config: &defaultConfig.zapConfig,
-	}
 	ConfigureLogger(defaultConfig)
 }
 
-func ConfigureLogger(logOptions *Options) *DemoLog {
-	if logOptions.CompareOptions() != defaultConfig.CompareOptions() {
-		DefaultLog.config.Level = logOptions.Level.Level()
-		DefaultLog.config.Development = logOptions.Development
+// New 按配置创建 logger，不修改 DefaultLog 和其他全局状态，需要替换包级别函数使用的 logger 时调用 SetDefault。
+// 多个 logger 写入同一个文件时共用一个 sink，切割配置以先创建的 logger 为准
+func New(o Options) (*DemoLog, error) {
+	zapConfig := zap.NewProductionConfig()
+	zapConfig.Encoding = ZapEncodeConsole.String()
+	zapConfig.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	zapConfig.DisableStacktrace = !o.EnableTrace
+	zapConfig.Level = o.Level.Level()
+	zapConfig.Development = o.Development
+	if o.Encoding != "" && o.Encoding.IsValid() {
+		zapConfig.Encoding = o.Encoding.String()
+	}
+	if !o.RotatePeriod.IsValid() {
+		return nil, fmt.Errorf("invalid rotate period %q", o.RotatePeriod)
+	}
+	if !o.Async.Overflow.IsValid() {
+		return nil, fmt.Errorf("invalid async overflow policy %q", o.Async.Overflow)
+	}
 
-		if logOptions.EnableTrace {
-			defaultConfig.zapConfig.DisableStacktrace = false
+	d := &DemoLog{config: &zapConfig, modules: o.Modules}
+	if o.LogPath != "" {
+		logPath := o.LogPath
+		if !path.IsAbs(logPath) {
+			pwd, _ := os.Getwd()
+			logPath = path.Join(pwd, logPath)
 		}
-		if logOptions.Encoding != "" && logOptions.Encoding.IsValid() {
-			DefaultLog.config.Encoding = logOptions.Encoding.String()
+		if err := os.MkdirAll(logPath, 0755); err != nil {
+			return nil, err
 		}
 
-		if logOptions.LogPath != "" {
-			pwd, _ := os.Getwd()
-			logPath := path.Join(pwd, logOptions.LogPath)
-			DefaultLog.logDir = logPath
+		d.logDir = logPath
+		if o.LogName == "" {
+			d.logBaseName = "app.log"
+		} else {
+			d.logBaseName = o.LogName + ".log"
+		}
+	}
 
-			if err := os.MkdirAll(DefaultLog.logDir, 0755); err != nil {
-				panic(err)
-			}
-			if logOptions.LogName == "" {
-				DefaultLog.logBaseName = "app.log"
-			} else {
-				DefaultLog.logBaseName = logOptions.LogName + ".log"
-			}
+	var masker *Masker
+	if o.Mask.Enable {
+		var err error
+		if masker, err = NewMasker(o.Mask); err != nil {
+			return nil, err
+		}
+	}
 
-			fullPath := path.Join(DefaultLog.logDir, DefaultLog.logBaseName)
-			var rotatePath string
-			if fullPath[0:1] == "/" {
-				rotatePath = fmt.Sprintf("rotate:/%%2F%s", fullPath[1:])
-			} else {
-				rotatePath = fmt.Sprintf("rotate:/%s", fullPath)
-			}
+	outputs := o.Outputs
+	if len(outputs) == 0 {
+		outputs = defaultOutputs(&o)
+	}
+	core, closers, err := outputCores(d, &o, outputs, zapConfig.EncoderConfig, masker)
+	d.closers = closers
+	if err != nil {
+		_ = d.Close()
+		return nil, err
+	}
 
-			DefaultLog.config.OutputPaths = append(DefaultLog.config.OutputPaths, rotatePath)
-			DefaultLog.config.ErrorOutputPaths = append(DefaultLog.config.ErrorOutputPaths, rotatePath)
+	// 替换 zap 按 OutputPaths 创建的 core，采样也需要自行添加
+	if !o.Sampling.Enable && zapConfig.Sampling != nil {
+		core = zapcore.NewSamplerWithOptions(core, time.Second, zapConfig.Sampling.Initial, zapConfig.Sampling.Thereafter)
+	}
+	core = o.Sampling.wrapCore(core)
+
+	// 以最低级别构建，再按全局级别和模块级别分别过滤，模块才能输出比全局更详细的日志
+	buildConfig := zapConfig
+	buildConfig.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
+	buildConfig.Sampling = nil
+	buildConfig.OutputPaths = nil
+	base, err := buildConfig.Build(wrapOutputs(core))
+	if err != nil {
+		_ = d.Close()
+		return nil, err
+	}
 
-			logRotate := logRotationConfig{initLumberjackConf(logOptions)}
+	d.setBase(base)
+	return d, nil
+}
 
-			_ = zap.RegisterSink("rotate", func(u *url.URL) (zap.Sink, error) {
-				logRotate.Filename = u.Path[1:]
-				return &logRotate, nil
-			})
-		}
+func (d *DemoLog) setBase(base *zap.Logger) {
+	d.base = base
+	d.direct = base.WithOptions(withLevel(d.config.Level)).Sugar()
+	d.SugaredLogger = d.direct
+	// Skip this wrapper in a call stack.
+	d.skip = d.direct.Desugar().WithOptions(zap.AddCallerSkip(1)).Sugar()
+}
+
+// SetDefault 替换包级别函数和 Named 使用的 logger，并应用其配置的模块级别
+func SetDefault(l *DemoLog) {
+	DefaultLog = l
+
+	resetNamed()
+	for name, level := range l.modules {
+		SetLevel(name, level)
 	}
+}
 
-	// Skip this wrapper in a call stack.
-	logger, err := DefaultLog.config.Build(zap.AddCallerSkip(1))
+// ConfigureLogger 按配置创建 logger 并替换 DefaultLog，之前由 ConfigureLogger 创建的 logger 会被关闭
+func ConfigureLogger(logOptions *Options) *DemoLog {
+	// 先释放之前的日志文件，新的切割配置才能生效，关闭后的 logger 仍可写入
+	if prev := DefaultLog; prev != nil && prev.owned {
+		_ = prev.Close()
+	}
+
+	l, err := New(*logOptions)
 	if err != nil {
 		panic(err)
 	}
-
-	DefaultLog.SugaredLogger = logger.Sugar()
+	l.owned = true
+	SetDefault(l)
 
 	return DefaultLog
 }
 
+// Sync 等待异步缓冲中的日志全部写出，并刷新所有输出
+func (d *DemoLog) Sync() error {
+	var err error
+	for _, c := range d.closers {
+		if w, ok := c.(*asyncWriter); ok {
+			if e := w.Flush(); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+
+	if e := d.SugaredLogger.Sync(); e != nil && err == nil {
+		err = e
+	}
+
+	return err
+}
+
+// Close 写出异步缓冲中的日志并关闭网络连接，之后仍在使用的 logger 同步写出或重新连接
+func (d *DemoLog) Close() error {
+	var err error
+	// 先关闭后创建的异步缓冲，再关闭它写入的连接
+	for i := len(d.closers) - 1; i >= 0; i-- {
+		if e := d.closers[i].Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// Sync 等待默认 logger 异步缓冲中的日志全部写出，并刷新所有输出，进程退出前调用
+func Sync() error {
+	return DefaultLog.Sync()
+}
+
 func Default() *zap.SugaredLogger {
-	return DefaultLog.SugaredLogger
+	return DefaultLog.skip
 }
 
 // Debug uses fmt.Sprint to construct and log a message.
@@ -129,14 +220,7 @@ func Info(args ...interface{}) {
 }
 
 func InfoWithTrace(ctx context.Context, args ...interface{}) {
-	spanData := extractSpan(ctx)
-	if spanData == nil {
-		Default().Info(args...)
-		return
-	}
-
-	l := With(spanData...)
-	l.Info(args...)
+	withTrace(ctx).Info(args...)
 }
 
 // Warn uses fmt.Sprint to construct and log a message.
@@ -145,14 +229,7 @@ func Warn(args ...interface{}) {
 }
 
 func WarnWithTrace(ctx context.Context, args ...interface{}) {
-	spanData := extractSpan(ctx)
-	if spanData == nil {
-		Default().Warn(args...)
-		return
-	}
-
-	l := With(spanData...)
-	l.Warn(args...)
+	withTrace(ctx).Warn(args...)
 }
 
 // Error uses fmt.Sprint to construct and log a message.
@@ -161,14 +238,7 @@ func Error(args ...interface{}) {
 }
 
 func ErrorWithTrace(ctx context.Context, args ...interface{}) {
-	spanData := extractSpan(ctx)
-	if spanData == nil {
-		Default().Error(args...)
-		return
-	}
-
-	l := With(spanData...)
-	l.Error(args...)
+	withTrace(ctx).Error(args...)
 }
 
 // Panic uses fmt.Sprint to construct and log a message, then panics.
@@ -202,14 +272,7 @@ func Infof(template string, args ...interface{}) {
 }
 
 func InfofWithTrace(ctx context.Context, template string, args ...interface{}) {
-	spanData := extractSpan(ctx)
-	if spanData == nil {
-		Default().Infof(template, args...)
-		return
-	}
-
-	l := With(spanData...)
-	l.Infof(template, args...)
+	withTrace(ctx).Infof(template, args...)
 }
 
 // Warnf uses fmt.Sprintf to log a templated message.
@@ -218,14 +281,7 @@ func Warnf(template string, args ...interface{}) {
 }
 
 func WarnfWithTrace(ctx context.Context, template string, args ...interface{}) {
-	spanData := extractSpan(ctx)
-	if spanData == nil {
-		Default().Warnf(template, args...)
-		return
-	}
-
-	l := With(spanData...)
-	l.Warnf(template, args...)
+	withTrace(ctx).Warnf(template, args...)
 }
 
 // Errorf uses fmt.Sprintf to log a templated message.
@@ -234,14 +290,7 @@ func Errorf(template string, args ...interface{}) {
 }
 
 func ErrorfWithTrace(ctx context.Context, template string, args ...interface{}) {
-	spanData := extractSpan(ctx)
-	if spanData == nil {
-		Default().Errorf(template, args...)
-		return
-	}
-
-	l := With(spanData...)
-	l.Errorf(template, args...)
+	withTrace(ctx).Errorf(template, args...)
 }
 
 // Panicf uses fmt.Sprintf to log a templated message, then panics.
@@ -281,6 +330,26 @@ func Errorw(msg string, keysAndValues ...interface{}) {
 	Default().Errorw(msg, keysAndValues...)
 }
 
+// DebugwWithTrace 同 Debugw，附带 ctx 中的 span 信息和 WithContext 字段
+func DebugwWithTrace(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	withTrace(ctx).Debugw(msg, keysAndValues...)
+}
+
+// InfowWithTrace 同 Infow，附带 ctx 中的 span 信息和 WithContext 字段
+func InfowWithTrace(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	withTrace(ctx).Infow(msg, keysAndValues...)
+}
+
+// WarnwWithTrace 同 Warnw，附带 ctx 中的 span 信息和 WithContext 字段
+func WarnwWithTrace(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	withTrace(ctx).Warnw(msg, keysAndValues...)
+}
+
+// ErrorwWithTrace 同 Errorw，附带 ctx 中的 span 信息和 WithContext 字段
+func ErrorwWithTrace(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	withTrace(ctx).Errorw(msg, keysAndValues...)
+}
+
 // Panicw logs a message with some additional context, then panics. The
 // variadic key-value pairs are treated as they are in With.
 func Panicw(msg string, keysAndValues ...interface{}) {
@@ -315,6 +384,11 @@ func With(args ...interface{}) *zap.SugaredLogger {
 	return Default().With(args...)
 }
 
+// SpanFields 返回 ctx 中 span 的 trace_id 和 span_id，格式与 With 的参数一致
+func SpanFields(ctx context.Context) []interface{} {
+	return extractSpan(ctx)
+}
+
 func extractSpan(ctx context.Context) []interface{} {
 	spanCtx, err := gadget.ExtractTraceSpan(ctx)
 	if err != nil {
@@ -344,10 +418,11 @@ type Logger interface {
 	Infof(msg string, args ...interface{})
 }
 
+// Error 实现 Logger，写入 d 本身而不是 DefaultLog
 func (d *DemoLog) Error(msg string) {
-	Default().Error(msg)
+	d.skip.Error(msg)
 }
 
 func (d *DemoLog) Infof(template string, args ...interface{}) {
-	Default().Infof(template, args...)
+	d.skip.Infof(template, args...)
 }
@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+	origin := DefaultLog
+
+	app, err := New(Options{Config: Config{Level: "info", LogPath: dir, LogName: "app"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Close()
+	audit, err := New(Options{Config: Config{Level: "debug", LogPath: dir, LogName: "audit", Encoding: ZapEncodeJSON}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer audit.Close()
+
+	// 不修改默认 logger
+	assert.Same(t, origin, DefaultLog)
+
+	app.Debug("app debug")
+	app.Info("app info")
+	audit.Debug("audit debug")
+	audit.Info("audit info")
+	var l Logger = audit
+	l.Error("audit error")
+
+	data, err := os.ReadFile(filepath.Join(dir, "app.log"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "app debug")
+	assert.Contains(t, string(data), "app info")
+
+	data, err = os.ReadFile(filepath.Join(dir, "audit.log"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"msg":"audit debug"`)
+	// 直接调用实例的方法时记录调用方的位置
+	assert.Contains(t, string(data), `"caller":"logger/log_test.go:`)
+	// Logger 接口的方法写入实例本身
+	assert.Contains(t, string(data), `"msg":"audit error"`)
+	assert.NotContains(t, string(data), `"caller":"logger/log.go:`)
+
+	_, err = New(Options{Config: Config{RotatePeriod: "weekly"}})
+	assert.Error(t, err)
+	_, err = New(Options{Config: Config{Outputs: []OutputConfig{{Target: OutputTCP}}}})
+	assert.Error(t, err)
+}
+
+func TestNewTestLogger(t *testing.T) {
+	origin := DefaultLog
+
+	t.Run("capture", func(t *testing.T) {
+		l, logs := NewTestLogger(t)
+		assert.Same(t, l, DefaultLog)
+
+		Debugw("created", "order_id", 42)
+		Named("kafka").Warn("retry")
+
+		entries := logs.All()
+		if assert.Len(t, entries, 2) {
+			assert.Equal(t, zapcore.DebugLevel, entries[0].Level)
+			assert.Equal(t, map[string]interface{}{"order_id": int64(42)}, entries[0].ContextMap())
+			assert.Contains(t, entries[0].Caller.File, "log_test.go")
+			assert.Equal(t, "kafka", entries[1].LoggerName)
+		}
+		assert.Equal(t, 1, logs.FilterMessage("retry").Len())
+	})
+
+	assert.Same(t, origin, DefaultLog)
+}
@@ -0,0 +1,380 @@
+package logger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// MaskStyle 脱敏方式
+type MaskStyle string
+
+const (
+	MaskPartial MaskStyle = "partial" // 保留首尾部分字符，如 138****5678、a***@example.com
+	MaskHash    MaskStyle = "hash"    // 替换为 SHA256 摘要的前 16 位，相同的值结果相同，便于关联排查
+	MaskFull    MaskStyle = "full"    // 整体替换为 ******
+)
+
+const maskedValue = "******"
+
+type MaskConfig struct {
+	Enable   bool       `yaml:"enable"`
+	Rules    []MaskRule `yaml:"rules"`     // 为空时使用全部内置规则
+	Keys     []string   `yaml:"keys"`      // 按字段名整体脱敏，大小写不敏感，如 password、token
+	KeyStyle MaskStyle  `yaml:"key_style"` // 字段名命中时的脱敏方式，默认 full
+}
+
+type MaskRule struct {
+	Name    string    `yaml:"name"`    // 内置规则 phone、email、id_card、bank_card，或自定义规则的名称
+	Pattern string    `yaml:"pattern"` // 自定义规则的正则，使用内置规则时为空
+	Style   MaskStyle `yaml:"style"`   // 默认 partial
+}
+
+type builtinRule struct {
+	pattern   string
+	minDigits int                 // 至少包含这么多连续数字时才执行正则
+	needle    byte                // 包含该字符时才执行正则
+	valid     func(v string) bool // 命中正则后再校验，不通过的不脱敏
+}
+
+// 按顺序执行，身份证号需要在银行卡号之前
+var builtinMaskRules = []string{"id_card", "bank_card", "phone", "email"}
+
+var builtinRules = map[string]builtinRule{
+	"id_card":   {pattern: `\b\d{17}[\dXx]\b`, minDigits: 17},
+	"bank_card": {pattern: `\b\d{16,19}\b`, minDigits: 16, valid: luhnValid},
+	"phone":     {pattern: `\b1[3-9]\d{9}\b`, minDigits: 11},
+	"email":     {pattern: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`, needle: '@'},
+}
+
+type maskRule struct {
+	builtinRule
+	re    *regexp.Regexp
+	style MaskStyle
+}
+
+// Masker 对日志内容脱敏
+type Masker struct {
+	rules    []*maskRule
+	keys     map[string]struct{}
+	keyStyle MaskStyle
+}
+
+func NewMasker(c MaskConfig) (*Masker, error) {
+	rules := c.Rules
+	if len(rules) == 0 {
+		for _, name := range builtinMaskRules {
+			rules = append(rules, MaskRule{Name: name})
+		}
+	}
+
+	m := &Masker{keys: make(map[string]struct{}), keyStyle: c.KeyStyle}
+	if m.keyStyle == "" {
+		m.keyStyle = MaskFull
+	}
+	for _, k := range c.Keys {
+		m.keys[strings.ToLower(k)] = struct{}{}
+	}
+
+	for _, r := range rules {
+		rule := &maskRule{style: r.Style}
+		if rule.style == "" {
+			rule.style = MaskPartial
+		}
+
+		if r.Pattern == "" {
+			b, ok := builtinRules[r.Name]
+			if !ok {
+				return nil, fmt.Errorf("unknown mask rule %q", r.Name)
+			}
+			rule.builtinRule = b
+		} else {
+			rule.pattern = r.Pattern
+		}
+
+		re, err := regexp.Compile(rule.pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compile mask rule %q failed: %s", r.Name, err.Error())
+		}
+		rule.re = re
+		m.rules = append(m.rules, rule)
+	}
+
+	return m, nil
+}
+
+// MaskString 按规则对文本脱敏，未命中时返回原字符串，不产生内存分配
+func (m *Masker) MaskString(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+
+	digits := -1
+	for _, r := range m.rules {
+		if r.needle != 0 && strings.IndexByte(s, r.needle) < 0 {
+			continue
+		}
+		if r.minDigits > 0 {
+			if digits < 0 {
+				digits = maxDigitRun(s)
+			}
+			if digits < r.minDigits {
+				continue
+			}
+		}
+
+		if !r.re.MatchString(s) {
+			continue
+		}
+
+		style, valid := r.style, r.valid
+		s = r.re.ReplaceAllStringFunc(s, func(v string) string {
+			if valid != nil && !valid(v) {
+				return v
+			}
+			return maskWithStyle(v, style)
+		})
+		digits = -1
+	}
+
+	return s
+}
+
+func (m *Masker) maskKey(key string) bool {
+	if len(m.keys) == 0 {
+		return false
+	}
+
+	_, ok := m.keys[strings.ToLower(key)]
+	return ok
+}
+
+// MaskField 对字段脱敏，未命中时原样返回
+func (m *Masker) MaskField(f zapcore.Field) zapcore.Field {
+	f, _ = m.maskField(f)
+	return f
+}
+
+func (m *Masker) maskField(f zapcore.Field) (zapcore.Field, bool) {
+	if m.maskKey(f.Key) {
+		if m.keyStyle == MaskFull {
+			return zap.String(f.Key, maskedValue), true
+		}
+		return zap.String(f.Key, maskWithStyle(fieldString(f), m.keyStyle)), true
+	}
+
+	switch f.Type {
+	case zapcore.StringType, zapcore.ByteStringType, zapcore.StringerType, zapcore.ErrorType:
+		s := fieldString(f)
+		if masked := m.MaskString(s); masked != s {
+			return zap.String(f.Key, masked), true
+		}
+	case zapcore.ReflectType:
+		return m.maskReflected(f)
+	}
+
+	return f, false
+}
+
+// maskReflected 对 zap.Any 等反射编码的值脱敏，字符串类的值直接处理，其他的值按 JSON 编码后处理
+func (m *Masker) maskReflected(f zapcore.Field) (zapcore.Field, bool) {
+	var s string
+	switch v := f.Interface.(type) {
+	case nil:
+		return f, false
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case error:
+		s = v.Error()
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return f, false
+		}
+		masked := m.MaskString(string(data))
+		if masked == string(data) {
+			return f, false
+		}
+		// 数字类型的值被替换后不再是合法的 JSON，此时按字符串输出
+		if json.Valid([]byte(masked)) {
+			return zap.Reflect(f.Key, json.RawMessage(masked)), true
+		}
+		return zap.String(f.Key, masked), true
+	}
+
+	if masked := m.MaskString(s); masked != s {
+		return zap.String(f.Key, masked), true
+	}
+
+	return f, false
+}
+
+func fieldString(f zapcore.Field) string {
+	switch f.Type {
+	case zapcore.StringType:
+		return f.String
+	case zapcore.ByteStringType:
+		return string(f.Interface.([]byte))
+	case zapcore.StringerType:
+		return fmt.Sprint(f.Interface)
+	case zapcore.ErrorType:
+		if err, ok := f.Interface.(error); ok && err != nil {
+			return err.Error()
+		}
+	}
+
+	if f.Interface != nil {
+		return fmt.Sprint(f.Interface)
+	}
+	if f.String != "" {
+		return f.String
+	}
+
+	return fmt.Sprint(f.Integer)
+}
+
+func maskWithStyle(s string, style MaskStyle) string {
+	switch style {
+	case MaskFull:
+		return maskedValue
+	case MaskHash:
+		sum := sha256.Sum256([]byte(s))
+		return "sha256:" + hex.EncodeToString(sum[:8])
+	default:
+		return maskPartial(s)
+	}
+}
+
+func maskPartial(s string) string {
+	if i := strings.IndexByte(s, '@'); i > 0 {
+		return s[:1] + "***" + s[i:]
+	}
+
+	r := []rune(s)
+	n := len(r)
+	var head, tail int
+	switch {
+	case n >= 11:
+		head, tail = 3, 4
+	case n >= 6:
+		head, tail = 1, 2
+	default:
+		return strings.Repeat("*", n)
+	}
+
+	return string(r[:head]) + strings.Repeat("*", n-head-tail) + string(r[n-tail:])
+}
+
+func maxDigitRun(s string) int {
+	var max, cur int
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			cur++
+			if cur > max {
+				max = cur
+			}
+			continue
+		}
+		cur = 0
+	}
+
+	return max
+}
+
+// luhnValid 银行卡号的 Luhn 校验，避免订单号等长数字被误脱敏
+func luhnValid(s string) bool {
+	var sum int
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+		d := int(s[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+
+	return sum%10 == 0
+}
+
+// maskEncoder 包装 zap 的 encoder，在写出前对消息和字段脱敏
+type maskEncoder struct {
+	zapcore.Encoder
+	masker *Masker
+}
+
+func newMaskEncoder(enc zapcore.Encoder, m *Masker) zapcore.Encoder {
+	return &maskEncoder{Encoder: enc, masker: m}
+}
+
+func (e *maskEncoder) Clone() zapcore.Encoder {
+	return &maskEncoder{Encoder: e.Encoder.Clone(), masker: e.masker}
+}
+
+// AddString 处理通过 With 添加的字段
+func (e *maskEncoder) AddString(key, value string) {
+	if e.masker.maskKey(key) {
+		e.Encoder.AddString(key, maskWithStyle(value, e.masker.keyStyle))
+		return
+	}
+
+	e.Encoder.AddString(key, e.masker.MaskString(value))
+}
+
+func (e *maskEncoder) AddByteString(key string, value []byte) {
+	e.AddString(key, string(value))
+}
+
+func (e *maskEncoder) AddReflected(key string, value interface{}) error {
+	if e.masker.maskKey(key) {
+		e.Encoder.AddString(key, maskWithStyle(fmt.Sprint(value), e.masker.keyStyle))
+		return nil
+	}
+
+	if f, ok := e.masker.maskReflected(zap.Reflect(key, value)); ok {
+		f.AddTo(e.Encoder)
+		return nil
+	}
+
+	return e.Encoder.AddReflected(key, value)
+}
+
+func (e *maskEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	ent.Message = e.masker.MaskString(ent.Message)
+
+	var masked []zapcore.Field
+	for i := range fields {
+		f, changed := e.masker.maskField(fields[i])
+		if !changed {
+			continue
+		}
+		// 有字段被脱敏时才复制，避免修改调用方的切片
+		if masked == nil {
+			masked = make([]zapcore.Field, len(fields))
+			copy(masked, fields)
+		}
+		masked[i] = f
+	}
+	if masked != nil {
+		fields = masked
+	}
+
+	return e.Encoder.EncodeEntry(ent, fields)
+}
@@ -0,0 +1,164 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func newTestMasker(t testing.TB, c MaskConfig) *Masker {
+	m, err := NewMasker(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func TestMaskString(t *testing.T) {
+	m := newTestMasker(t, MaskConfig{})
+
+	cases := map[string]string{
+		"phone 13812345678 bound":                       "phone 138****5678 bound",
+		"SELECT * FROM user WHERE mobile='13812345678'": "SELECT * FROM user WHERE mobile='138****5678'",
+		"mail to alice.w@example.com":                   "mail to a***@example.com",
+		"id 11010519491231002X":                         "id 110***********002X",
+		"card 6222020200112233446":                      "card 622************3446",
+		"order 6222020200112233445":                     "order 6222020200112233445",
+		"order 20231019 amount 12":                      "order 20231019 amount 12",
+		"no sensitive data":                             "no sensitive data",
+		"x13812345678":                                  "x13812345678",
+	}
+	for in, out := range cases {
+		assert.Equal(t, out, m.MaskString(in), in)
+	}
+
+	m = newTestMasker(t, MaskConfig{Rules: []MaskRule{
+		{Name: "phone", Style: MaskFull},
+		{Name: "order", Pattern: `ORD-\d+`, Style: MaskHash},
+	}})
+	assert.Regexp(t, `^call \*{6} about sha256:[0-9a-f]{16}$`, m.MaskString("call 13812345678 about ORD-1"))
+
+	_, err := NewMasker(MaskConfig{Rules: []MaskRule{{Name: "unknown"}}})
+	assert.Error(t, err)
+	_, err = NewMasker(MaskConfig{Rules: []MaskRule{{Name: "bad", Pattern: "("}}})
+	assert.Error(t, err)
+}
+
+func TestMaskEncoder(t *testing.T) {
+	m := newTestMasker(t, MaskConfig{Keys: []string{"Password", "token"}})
+
+	buf := &bytes.Buffer{}
+	encoderConf := zap.NewProductionEncoderConfig()
+	encoderConf.TimeKey = ""
+	core := zapcore.NewCore(newMaskEncoder(zapcore.NewJSONEncoder(encoderConf), m), zapcore.AddSync(buf), zapcore.DebugLevel)
+	l := zap.New(core).With(zap.String("token", "abc"), zap.String("mobile", "13812345678"))
+
+	fields := []zap.Field{
+		zap.String("password", "p@ss"),
+		zap.ByteString("email", []byte("bob@example.com")),
+		zap.Error(errors.New("duplicate entry '13912345678'")),
+		zap.Int("count", 1),
+	}
+	l.Info("sql: UPDATE user SET mobile='13712345678'", fields...)
+
+	assert.JSONEq(t, `{"level":"info","msg":"sql: UPDATE user SET mobile='137****5678'",
+		"token":"******","mobile":"138****5678","password":"******","email":"b***@example.com",
+		"error":"duplicate entry '139****5678'","count":1}`, buf.String())
+	// 调用方的字段不被修改
+	assert.Equal(t, "p@ss", fields[0].String)
+}
+
+func TestMaskEncoderReflected(t *testing.T) {
+	m := newTestMasker(t, MaskConfig{Keys: []string{"secret"}, KeyStyle: MaskPartial})
+
+	buf := &bytes.Buffer{}
+	encoderConf := zap.NewProductionEncoderConfig()
+	encoderConf.TimeKey = ""
+	core := zapcore.NewCore(newMaskEncoder(zapcore.NewJSONEncoder(encoderConf), m), zapcore.AddSync(buf), zapcore.DebugLevel)
+	type contact struct {
+		Mobile string `json:"mobile"`
+		Card   int64  `json:"card"`
+	}
+	l := zap.New(core).With(zap.Any("secret", "abcdefgh"), zap.Any("user", contact{Mobile: "13812345678"}))
+
+	l.Info("reflected",
+		zap.Reflect("email", "bob@example.com"),
+		zap.Any("contact", map[string]string{"mobile": "13912345678"}),
+		zap.Any("card", contact{Card: 6222020200112233446}),
+		zap.Any("plain", contact{Mobile: "10086"}))
+
+	assert.JSONEq(t, `{"level":"info","msg":"reflected","secret":"a*****gh","user":{"mobile":"138****5678","card":0},
+		"email":"b***@example.com","contact":{"mobile":"139****5678"},"card":"{\"mobile\":\"\",\"card\":622************3446}",
+		"plain":{"mobile":"10086","card":0}}`, buf.String())
+}
+
+func TestNewWithMask(t *testing.T) {
+	dir := t.TempDir()
+	l, err := New(Options{Config: Config{Level: "info", Encoding: ZapEncodeJSON, LogPath: dir,
+		Outputs: []OutputConfig{{Target: OutputFile}}, Mask: MaskConfig{Enable: true}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	l.Infow("bind phone 13812345678", "email", "bob@example.com")
+	data, err := os.ReadFile(filepath.Join(dir, "app.log"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"msg":"bind phone 138****5678","email":"b***@example.com"`)
+}
+
+func benchmarkMaskLogger(b *testing.B, m *Masker) *zap.Logger {
+	enc := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	if m != nil {
+		enc = newMaskEncoder(enc, m)
+	}
+
+	return zap.New(zapcore.NewCore(enc, zapcore.AddSync(io.Discard), zapcore.DebugLevel))
+}
+
+func BenchmarkMaskEncoder(b *testing.B) {
+	m := newTestMasker(b, MaskConfig{Keys: []string{"password"}})
+	fields := []zap.Field{zap.String("uri", "/api/v1/orders"), zap.Int("status", 200), zap.String("client", "10.0.0.1")}
+
+	b.Run("baseline", func(b *testing.B) {
+		l := benchmarkMaskLogger(b, nil)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			l.Info("request finished", fields...)
+		}
+	})
+
+	b.Run("no_match", func(b *testing.B) {
+		l := benchmarkMaskLogger(b, m)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			l.Info("request finished", fields...)
+		}
+	})
+
+	b.Run("match", func(b *testing.B) {
+		l := benchmarkMaskLogger(b, m)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			l.Info("SELECT * FROM user WHERE mobile='13812345678'", zap.String("password", "secret"), zap.String("email", "bob@example.com"))
+		}
+	})
+}
+
+func BenchmarkMaskString(b *testing.B) {
+	m := newTestMasker(b, MaskConfig{})
+	sql := "SELECT id, name FROM orders WHERE created_at > '2021-11-10 10:55:00' AND status = 1 LIMIT 20"
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		m.MaskString(sql)
+	}
+}
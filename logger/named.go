@@ -0,0 +1,163 @@
+package logger
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	namedLock    sync.RWMutex
+	namedLevels  = make(map[string]*moduleLevel)
+	namedLoggers = make(map[namedKey]*zap.SugaredLogger)
+)
+
+type namedKey struct {
+	name string
+	skip bool
+}
+
+// moduleLevel 模块的日志级别，未单独设置时跟随全局级别
+type moduleLevel struct {
+	override int32
+	level    zap.AtomicLevel
+}
+
+func (m *moduleLevel) Enabled(l zapcore.Level) bool {
+	if atomic.LoadInt32(&m.override) == 1 {
+		return m.level.Enabled(l)
+	}
+
+	return DefaultLog.config.Level.Enabled(l)
+}
+
+// levelCore 用单独的级别过滤 core，底层 core 以最低级别构建
+type levelCore struct {
+	zapcore.Core
+	level zapcore.LevelEnabler
+}
+
+func (c *levelCore) Enabled(l zapcore.Level) bool {
+	return c.level.Enabled(l)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), level: c.level}
+}
+
+func (c *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.level.Enabled(ent.Level) {
+		return ce
+	}
+
+	return c.Core.Check(ent, ce)
+}
+
+func withLevel(level zapcore.LevelEnabler) zap.Option {
+	return zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &levelCore{Core: core, level: level}
+	})
+}
+
+// Named 返回模块的 logger，日志带有模块名，级别可以通过 SetLevel 单独调整。
+// 重新 ConfigureLogger 后需要重新获取。
+func Named(name string) *zap.SugaredLogger {
+	return named(namedKey{name: name})
+}
+
+// NamedSkip 与 Named 相同，但与 Default 一样跳过一层调用栈，供封装了日志方法的适配器使用
+func NamedSkip(name string) *zap.SugaredLogger {
+	return named(namedKey{name: name, skip: true})
+}
+
+func named(key namedKey) *zap.SugaredLogger {
+	namedLock.RLock()
+	l, ok := namedLoggers[key]
+	namedLock.RUnlock()
+	if ok {
+		return l
+	}
+
+	namedLock.Lock()
+	defer namedLock.Unlock()
+
+	if l, ok = namedLoggers[key]; ok {
+		return l
+	}
+
+	opts := []zap.Option{withLevel(levelOf(key.name))}
+	if key.skip {
+		opts = append(opts, zap.AddCallerSkip(1))
+	}
+	l = DefaultLog.base.WithOptions(opts...).Named(key.name).Sugar()
+	namedLoggers[key] = l
+
+	return l
+}
+
+// SetLevel 单独设置模块的日志级别
+func SetLevel(name string, level LogLevel) {
+	namedLock.Lock()
+	defer namedLock.Unlock()
+
+	m := levelOf(name)
+	m.level.SetLevel(level.parse())
+	atomic.StoreInt32(&m.override, 1)
+}
+
+// ResetLevel 取消模块单独设置的级别，恢复跟随全局级别
+func ResetLevel(name string) {
+	namedLock.Lock()
+	defer namedLock.Unlock()
+
+	atomic.StoreInt32(&levelOf(name).override, 0)
+}
+
+// ModuleLevel 模块当前的日志级别
+type ModuleLevel struct {
+	Name     string `json:"name"`
+	Level    string `json:"level"`
+	Override bool   `json:"override"`
+}
+
+// Levels 返回所有模块的日志级别
+func Levels() []ModuleLevel {
+	namedLock.RLock()
+	defer namedLock.RUnlock()
+
+	res := make([]ModuleLevel, 0, len(namedLevels))
+	for name, m := range namedLevels {
+		ml := ModuleLevel{Name: name, Override: atomic.LoadInt32(&m.override) == 1}
+		if ml.Override {
+			ml.Level = m.level.String()
+		} else {
+			ml.Level = DefaultLog.config.Level.String()
+		}
+		res = append(res, ml)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+
+	return res
+}
+
+// levelOf 调用方需持有写锁
+func levelOf(name string) *moduleLevel {
+	m, ok := namedLevels[name]
+	if !ok {
+		m = &moduleLevel{level: zap.NewAtomicLevel()}
+		namedLevels[name] = m
+	}
+
+	return m
+}
+
+// resetNamed 在重新构建 logger 后清除缓存的模块 logger，模块级别保持不变
+func resetNamed() {
+	namedLock.Lock()
+	defer namedLock.Unlock()
+
+	namedLoggers = make(map[namedKey]*zap.SugaredLogger)
+}
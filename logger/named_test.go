@@ -0,0 +1,75 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestNamedLevel(t *testing.T) {
+	DefaultLog.config.Level.SetLevel(zapcore.InfoLevel)
+
+	buf := &bytes.Buffer{}
+	core := zapcore.NewCore(zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig()), zapcore.AddSync(buf), zapcore.DebugLevel)
+
+	namedLock.Lock()
+	l := zap.New(core, withLevel(levelOf("test-module"))).Named("test-module").Sugar()
+	namedLock.Unlock()
+
+	// 默认跟随全局级别
+	l.Debug("hidden")
+	assert.Empty(t, buf.String())
+
+	SetLevel("test-module", "debug")
+	l.Debug("visible")
+	assert.Contains(t, buf.String(), "test-module\tvisible")
+	assert.False(t, DefaultLog.config.Level.Enabled(zapcore.DebugLevel))
+
+	buf.Reset()
+	ResetLevel("test-module")
+	l.Debug("hidden")
+	l.Info("info")
+	assert.NotContains(t, buf.String(), "hidden")
+	assert.Contains(t, buf.String(), "info")
+
+	SetLevel("test-module", "error")
+	assert.Contains(t, Levels(), ModuleLevel{Name: "test-module", Level: "error", Override: true})
+}
+
+func TestNamed(t *testing.T) {
+	assert.Same(t, Named("named-cache"), Named("named-cache"))
+	assert.NotNil(t, Default())
+}
+
+func TestNamedCaller(t *testing.T) {
+	buf := &bytes.Buffer{}
+	encoderConf := zap.NewProductionEncoderConfig()
+	encoderConf.TimeKey = ""
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConf), zapcore.AddSync(buf), zapcore.DebugLevel)
+
+	origin := DefaultLog
+	defer SetDefault(origin)
+	d := &DemoLog{config: &zap.Config{Level: zap.NewAtomicLevelAt(zapcore.InfoLevel)}}
+	d.setBase(zap.New(core, zap.AddCaller()))
+	SetDefault(d)
+
+	// 直接调用时记录调用方，适配器跳过自身的一层
+	Named("caller").Info("direct")
+	_, _, line, _ := runtime.Caller(0)
+	assert.Contains(t, buf.String(), fmt.Sprintf(`"caller":"logger/named_test.go:%d"`, line-1))
+
+	buf.Reset()
+	logThrough("adapter")
+	_, _, line, _ = runtime.Caller(0)
+	assert.Contains(t, buf.String(), fmt.Sprintf(`"caller":"logger/named_test.go:%d"`, line-1))
+	assert.NotSame(t, Named("caller"), NamedSkip("caller"))
+}
+
+func logThrough(msg string) {
+	NamedSkip("caller").Info(msg)
+}
@@ -0,0 +1,325 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// OutputTarget 日志输出目标
+type OutputTarget string
+
+const (
+	OutputStdout OutputTarget = "stdout"
+	OutputStderr OutputTarget = "stderr"
+	OutputFile   OutputTarget = "file"   // log_path 下的文件，按全局配置切割
+	OutputSyslog OutputTarget = "syslog" // 通过 unix socket 写入本机 syslog
+	OutputTCP    OutputTarget = "tcp"    // 每行一条日志写入 TCP 连接，如 logstash
+	OutputKafka  OutputTarget = "kafka"  // 以 JSON 格式批量发送到 kafka，需要先通过 kafka 包的 BuildKafka 注册生产者
+)
+
+type OutputConfig struct {
+	Target   OutputTarget    `yaml:"target"`
+	MinLevel LogLevel        `yaml:"min_level"` // 默认 debug，仍受全局级别限制
+	MaxLevel LogLevel        `yaml:"max_level"` // 默认 fatal
+	Encoding ZapConfEncoding `yaml:"encoding"`  // 默认与全局 encoding 相同
+	FileName string          `yaml:"file_name"` // target 为 file 时的文件名，不含 .log 后缀，默认与 log_name 相同；kafka 不可用时写入的本地文件，默认为 <log_name>-kafka
+	Address  string          `yaml:"address"`   // syslog 的 socket 路径，默认 /dev/log；tcp 的地址
+	Tag      string          `yaml:"tag"`       // syslog 的 tag，kafka 消息 key 中的服务名，默认为进程名
+	Topic    string          `yaml:"topic"`     // kafka 的 topic
+}
+
+func (out OutputConfig) tag() string {
+	if out.Tag != "" {
+		return out.Tag
+	}
+
+	return filepath.Base(os.Args[0])
+}
+
+// levelRange 输出 [min, max] 范围内的日志
+type levelRange struct {
+	min, max zapcore.Level
+}
+
+func (r levelRange) Enabled(l zapcore.Level) bool {
+	return l >= r.min && l <= r.max
+}
+
+func parseLevelOr(l LogLevel, def zapcore.Level) (zapcore.Level, error) {
+	if l == "" {
+		return def, nil
+	}
+
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(l)); err != nil {
+		return def, err
+	}
+
+	return level, nil
+}
+
+// outputCores 按 outputs 配置创建 core，返回的 closer 在重新配置时关闭
+func outputCores(d *DemoLog, o *Options, outputs []OutputConfig, encoderConf zapcore.EncoderConfig, masker *Masker) (zapcore.Core, []io.Closer, error) {
+	var cores []zapcore.Core
+	var closers []io.Closer
+	// 多个输出写入同一个目标时共用 sink 和异步缓冲
+	sinks := make(map[string]zapcore.WriteSyncer)
+	for i, out := range outputs {
+		min, err := parseLevelOr(out.MinLevel, zapcore.DebugLevel)
+		if err != nil {
+			return nil, closers, fmt.Errorf("output %d: %s", i, err.Error())
+		}
+		max, err := parseLevelOr(out.MaxLevel, zapcore.FatalLevel)
+		if err != nil {
+			return nil, closers, fmt.Errorf("output %d: %s", i, err.Error())
+		}
+		level := levelRange{min: min, max: max}
+
+		encoding := out.Encoding
+		if encoding == "" {
+			encoding = o.Encoding
+		}
+		if encoding == "" {
+			encoding = ZapEncodeConsole
+		}
+		if !encoding.IsValid() {
+			return nil, closers, fmt.Errorf("output %d: invalid encoding %q", i, encoding)
+		}
+		enc := zapcore.NewConsoleEncoder(encoderConf)
+		if encoding == ZapEncodeJSON {
+			enc = zapcore.NewJSONEncoder(encoderConf)
+		}
+		if masker != nil {
+			enc = newMaskEncoder(enc, masker)
+		}
+
+		switch out.Target {
+		case OutputSyslog:
+			addr := out.Address
+			if addr == "" {
+				addr = "/dev/log"
+			}
+			w := &netWriter{network: "unixgram", addr: addr}
+			closers = append(closers, w)
+			cores = append(cores, &syslogCore{LevelEnabler: level, enc: enc, w: w, tag: out.tag(), pid: os.Getpid()})
+			continue
+		case OutputKafka:
+			if out.Topic == "" {
+				return nil, closers, fmt.Errorf("output %d: kafka topic is required", i)
+			}
+			core, cs := newKafkaCore(d, o, out, encoderConf, masker, level)
+			closers = append(closers, cs...)
+			cores = append(cores, core)
+			continue
+		}
+
+		var key string
+		switch out.Target {
+		case OutputStdout, OutputStderr:
+			key = string(out.Target)
+		case OutputFile:
+			name := out.FileName
+			if name == "" {
+				name = d.logName()
+			}
+			key = filepath.Join(d.logDir, name+".log")
+		case OutputTCP:
+			if out.Address == "" {
+				return nil, closers, fmt.Errorf("output %d: tcp address is required", i)
+			}
+			key = "tcp:" + out.Address
+		default:
+			return nil, closers, fmt.Errorf("output %d: unknown target %q", i, out.Target)
+		}
+
+		ws, ok := sinks[key]
+		if !ok {
+			switch out.Target {
+			case OutputStdout:
+				ws = zapcore.Lock(os.Stdout)
+			case OutputStderr:
+				ws = zapcore.Lock(os.Stderr)
+			case OutputFile:
+				var release io.Closer
+				ws, release = acquireRotateSink(key, o)
+				closers = append(closers, release)
+			case OutputTCP:
+				w := &netWriter{network: "tcp", addr: out.Address}
+				closers = append(closers, w)
+				ws = w
+			}
+			if o.Async.Enable {
+				w := newAsyncWriter(key, ws, o.Async)
+				closers = append(closers, w)
+				ws = w
+			}
+			sinks[key] = ws
+		}
+
+		if w, ok := ws.(*asyncWriter); ok {
+			cores = append(cores, &asyncCore{LevelEnabler: level, enc: enc, w: w})
+		} else {
+			cores = append(cores, zapcore.NewCore(enc, ws, level))
+		}
+	}
+
+	return zapcore.NewTee(cores...), closers, nil
+}
+
+// logName 不含 .log 后缀的 log_name
+func (d *DemoLog) logName() string {
+	if d.logBaseName == "" {
+		return "app"
+	}
+
+	return strings.TrimSuffix(d.logBaseName, ".log")
+}
+
+// defaultOutputs 未配置 Outputs 时写入 stderr 和 log_path 下的文件
+func defaultOutputs(o *Options) []OutputConfig {
+	outputs := []OutputConfig{{Target: OutputStderr}}
+	if o.LogPath != "" {
+		outputs = append(outputs, OutputConfig{Target: OutputFile})
+	}
+
+	return outputs
+}
+
+// 连接失败后，这段时间内的日志直接丢弃，不再重新连接
+const netRetryInterval = 5 * time.Second
+
+// netWriter 在首次写入和写入失败后重新连接
+type netWriter struct {
+	network string
+	addr    string
+	lock    sync.Mutex
+	conn    net.Conn
+	retryAt time.Time
+}
+
+func (w *netWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.conn == nil {
+		// 避免每条日志都等待连接超时
+		if time.Now().Before(w.retryAt) {
+			return len(p), nil
+		}
+
+		conn, err := w.dial()
+		if err != nil {
+			w.retryAt = time.Now().Add(netRetryInterval)
+			return 0, err
+		}
+		w.conn = conn
+	}
+
+	n, err := w.conn.Write(p)
+	if err != nil {
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+
+	return n, err
+}
+
+func (w *netWriter) dial() (net.Conn, error) {
+	conn, err := net.DialTimeout(w.network, w.addr, 3*time.Second)
+	if err != nil && w.network == "unixgram" {
+		// 部分系统的 syslog 只监听 stream socket
+		conn, err = net.DialTimeout("unix", w.addr, 3*time.Second)
+	}
+
+	return conn, err
+}
+
+func (w *netWriter) Sync() error { return nil }
+
+func (w *netWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// syslogCore 以 RFC 3164 格式写入 syslog，priority 由日志级别决定
+type syslogCore struct {
+	zapcore.LevelEnabler
+	enc zapcore.Encoder
+	w   *netWriter
+	tag string
+	pid int
+}
+
+func (c *syslogCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.enc = c.enc.Clone()
+	for i := range fields {
+		fields[i].AddTo(clone.enc)
+	}
+
+	return &clone
+}
+
+func (c *syslogCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+
+	return ce
+}
+
+func (c *syslogCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+
+	msg := strings.TrimRight(buf.String(), "\n")
+	_, err = fmt.Fprintf(c.w, "<%d>%s %s[%d]: %s", syslogPriority(ent.Level), ent.Time.Format(time.Stamp), c.tag, c.pid, msg)
+	return err
+}
+
+func (c *syslogCore) Sync() error { return nil }
+
+// syslogPriority facility 为 user
+func syslogPriority(l zapcore.Level) int {
+	const facilityUser = 1 << 3
+
+	switch l {
+	case zapcore.DebugLevel:
+		return facilityUser | 7
+	case zapcore.InfoLevel:
+		return facilityUser | 6
+	case zapcore.WarnLevel:
+		return facilityUser | 4
+	case zapcore.ErrorLevel:
+		return facilityUser | 3
+	case zapcore.DPanicLevel, zapcore.PanicLevel:
+		return facilityUser | 2
+	default:
+		return facilityUser | 0
+	}
+}
+
+// wrapOutputs 用 Outputs 配置的 core 替换 zap 按 OutputPaths 创建的 core
+func wrapOutputs(core zapcore.Core) zap.Option {
+	return zap.WrapCore(func(zapcore.Core) zapcore.Core { return core })
+}
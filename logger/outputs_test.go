@@ -0,0 +1,135 @@
+package logger
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func newOutputLogger(t *testing.T, dir string, outputs ...OutputConfig) *zap.Logger {
+	encoderConf := zap.NewProductionEncoderConfig()
+	encoderConf.TimeKey = ""
+	core, closers, err := outputCores(&DemoLog{logDir: dir}, &Options{}, outputs, encoderConf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, c := range closers {
+			_ = c.Close()
+		}
+	})
+
+	return zap.New(core)
+}
+
+func TestOutputFiles(t *testing.T) {
+	dir := t.TempDir()
+	l := newOutputLogger(t, dir,
+		OutputConfig{Target: OutputFile, FileName: "app", Encoding: ZapEncodeJSON, MaxLevel: "warn"},
+		OutputConfig{Target: OutputFile, FileName: "error", Encoding: ZapEncodeJSON, MinLevel: "error"},
+	)
+	l.Info("created")
+	l.Error("failed")
+	assert.NoError(t, l.Sync())
+
+	app, err := os.ReadFile(filepath.Join(dir, "app.log"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"level":"info","msg":"created"}`, string(app))
+
+	errLog, err := os.ReadFile(filepath.Join(dir, "error.log"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"level":"error","msg":"failed"}`, string(errLog))
+}
+
+func TestOutputNetwork(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	syslogAddr := filepath.Join(t.TempDir(), "log.sock")
+	syslog, err := net.ListenPacket("unixgram", syslogAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syslog.Close()
+
+	l := newOutputLogger(t, "",
+		OutputConfig{Target: OutputTCP, Address: ln.Addr().String(), Encoding: ZapEncodeJSON},
+		OutputConfig{Target: OutputSyslog, Address: syslogAddr, Tag: "demo", MinLevel: "warn"},
+	)
+	l.Info("tcp only")
+	l.Error("both", zap.Int("code", 1))
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	line, _ := r.ReadString('\n')
+	assert.JSONEq(t, `{"level":"info","msg":"tcp only"}`, line)
+	line, _ = r.ReadString('\n')
+	assert.JSONEq(t, `{"level":"error","msg":"both","code":1}`, line)
+
+	buf := make([]byte, 1024)
+	n, _, err := syslog.ReadFrom(buf)
+	assert.NoError(t, err)
+	msg := string(buf[:n])
+	assert.True(t, strings.HasPrefix(msg, "<11>"), msg)
+	assert.Contains(t, msg, " demo[")
+	assert.True(t, strings.HasSuffix(msg, "]: error\tboth\t{\"code\": 1}"), msg)
+}
+
+func TestNetWriterRetry(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = ln.Close()
+
+	w := &netWriter{network: "tcp", addr: ln.Addr().String()}
+	_, err = w.Write([]byte("first\n"))
+	assert.Error(t, err)
+
+	// 连接失败后暂停重连，直接丢弃
+	n, err := w.Write([]byte("second\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 7, n)
+	assert.Nil(t, w.conn)
+
+	w.retryAt = time.Time{}
+	_, err = w.Write([]byte("third\n"))
+	assert.Error(t, err)
+}
+
+func TestOutputInvalid(t *testing.T) {
+	_, _, err := outputCores(&DemoLog{}, &Options{}, []OutputConfig{{Target: "kafka"}}, zapcore.EncoderConfig{}, nil)
+	assert.Error(t, err)
+	_, _, err = outputCores(&DemoLog{}, &Options{}, []OutputConfig{{Target: OutputStdout, MinLevel: "verbose"}}, zapcore.EncoderConfig{}, nil)
+	assert.Error(t, err)
+}
+
+func TestConfigureLoggerWithOutputs(t *testing.T) {
+	dir := t.TempDir()
+	opts := &Options{Config: Config{Level: "info", LogPath: dir, Outputs: []OutputConfig{
+		{Target: OutputStderr},
+		{Target: OutputFile, FileName: "error", Encoding: ZapEncodeJSON, MinLevel: "error"},
+	}}}
+	assert.NotPanics(t, func() { ConfigureLogger(opts) })
+	defer ConfigureLogger(defaultConfig)
+
+	Error("configured")
+	errLog, err := os.ReadFile(filepath.Join(dir, "error.log"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(errLog), `"msg":"configured"`)
+}
@@ -0,0 +1,460 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RotatePeriod 按时间切割日志的周期
+type RotatePeriod string
+
+const (
+	RotateNone   RotatePeriod = ""       // 只按大小切割
+	RotateHourly RotatePeriod = "hourly" // 文件名如 app-2021111015.log
+	RotateDaily  RotatePeriod = "daily"  // 文件名如 app-20211110.log
+)
+
+func (p RotatePeriod) IsValid() bool {
+	return p == RotateNone || p == RotateHourly || p == RotateDaily
+}
+
+func (p RotatePeriod) layout() string {
+	switch p {
+	case RotateHourly:
+		return "2006010215"
+	case RotateDaily:
+		return "20060102"
+	default:
+		return ""
+	}
+}
+
+// next 返回 t 所在周期的结束时间
+func (p RotatePeriod) next(t time.Time) time.Time {
+	switch p {
+	case RotateHourly:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location()).Add(time.Hour)
+	case RotateDaily:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).AddDate(0, 0, 1)
+	default:
+		return time.Time{}
+	}
+}
+
+var (
+	rotateLock sync.Mutex
+	// 同一个文件的 sink 在多个 logger 间共用，否则会重复切割
+	rotateSinks = make(map[string]*rotateSink)
+)
+
+// rotateSink 记录共用 sink 的 logger 数量
+type rotateSink struct {
+	sink zap.Sink
+	refs int
+}
+
+// acquireRotateSink 按配置为日志文件获取 sink，只按大小切割时沿用 lumberjack。
+// 已有 logger 在使用该文件时直接共用其 sink，切割配置以先创建的为准，不会修改或关闭其他 logger 的 sink；
+// 返回的 closer 在 logger 关闭时释放引用，最后一个引用释放后关闭 sink。
+func acquireRotateSink(filename string, o *Options) (zap.Sink, io.Closer) {
+	rotateLock.Lock()
+	defer rotateLock.Unlock()
+
+	s, ok := rotateSinks[filename]
+	if !ok {
+		s = &rotateSink{sink: newRotateSink(filename, o)}
+		rotateSinks[filename] = s
+	}
+	s.refs++
+
+	return s.sink, &rotateSinkRef{filename: filename, s: s}
+}
+
+func newRotateSink(filename string, o *Options) zap.Sink {
+	if o.RotatePeriod == RotateNone && o.MaxTotalSize == 0 {
+		logRotate := logRotationConfig{initLumberjackConf(o)}
+		logRotate.Filename = filename
+		return &logRotate
+	}
+
+	return newRotateWriter(filename, newRotateConfig(o))
+}
+
+// rotateSinkRef 释放 acquireRotateSink 获取的引用，可重复调用
+type rotateSinkRef struct {
+	filename string
+	s        *rotateSink
+	once     sync.Once
+}
+
+func (r *rotateSinkRef) Close() (err error) {
+	r.once.Do(func() {
+		rotateLock.Lock()
+		defer rotateLock.Unlock()
+
+		if r.s.refs--; r.s.refs > 0 {
+			return
+		}
+		if rotateSinks[r.filename] == r.s {
+			delete(rotateSinks, r.filename)
+		}
+		err = r.s.sink.Close()
+	})
+
+	return
+}
+
+type rotateConfig struct {
+	period       RotatePeriod
+	maxSize      int64 // bytes
+	maxAge       time.Duration
+	maxBackups   int
+	maxTotalSize int64 // bytes
+	localTime    bool
+	compress     bool
+	symlink      bool
+}
+
+func newRotateConfig(o *Options) rotateConfig {
+	o.setRotateDefaults()
+
+	return rotateConfig{
+		period:       o.RotatePeriod,
+		maxSize:      int64(o.MaxSize) * megabyte,
+		maxAge:       time.Duration(o.MaxAge) * 24 * time.Hour,
+		maxBackups:   o.MaxBackups,
+		maxTotalSize: int64(o.MaxTotalSize) * megabyte,
+		localTime:    o.LocalTime,
+		compress:     o.Compress,
+		symlink:      o.Symlink,
+	}
+}
+
+const megabyte = 1024 * 1024
+
+// rotateWriter 按时间和大小切割日志文件，并按数量、时间和总大小清理旧文件。
+// 按时间切割时当前文件名带有周期，如 app-20211110.log，超过大小后依次移动为 app-20211110.1.log、app-20211110.2.log；
+// 只按大小切割时当前文件为 app.log，旧文件为 app.1.log、app.2.log。
+type rotateWriter struct {
+	lock     sync.Mutex
+	conf     rotateConfig
+	dir      string
+	name     string // 不含 .log 后缀
+	file     *os.File
+	size     int64
+	next     time.Time
+	now      func() time.Time
+	backupRe *regexp.Regexp
+
+	millCh   chan struct{}
+	millOnce sync.Once
+}
+
+func newRotateWriter(filename string, conf rotateConfig) *rotateWriter {
+	name := strings.TrimSuffix(filepath.Base(filename), ".log")
+
+	return &rotateWriter{
+		conf:     conf,
+		dir:      filepath.Dir(filename),
+		name:     name,
+		now:      time.Now,
+		backupRe: regexp.MustCompile(`^` + regexp.QuoteMeta(name) + `(-\d{8}|-\d{10})?(\.\d+)?\.log(\.gz)?$`),
+	}
+}
+
+func (w *rotateWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	now := w.currentTime()
+	if w.file == nil {
+		if err := w.openLocked(now); err != nil {
+			return 0, err
+		}
+	} else if w.conf.period != RotateNone && !now.Before(w.next) {
+		if err := w.rotateLocked(now, false); err != nil {
+			return 0, err
+		}
+	}
+
+	if w.conf.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.conf.maxSize {
+		if err := w.rotateLocked(now, true); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+
+	return n, err
+}
+
+func (w *rotateWriter) Sync() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+
+	return w.file.Sync()
+}
+
+func (w *rotateWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.closeLocked()
+}
+
+func (w *rotateWriter) closeLocked() error {
+	if w.file == nil {
+		return nil
+	}
+
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *rotateWriter) currentTime() time.Time {
+	if w.conf.localTime {
+		return w.now()
+	}
+
+	return w.now().UTC()
+}
+
+// filename 返回 t 时刻应写入的文件
+func (w *rotateWriter) filename(t time.Time) string {
+	if w.conf.period == RotateNone {
+		return filepath.Join(w.dir, w.name+".log")
+	}
+
+	return filepath.Join(w.dir, w.name+"-"+t.Format(w.conf.period.layout())+".log")
+}
+
+func (w *rotateWriter) openLocked(now time.Time) error {
+	filename := w.filename(now)
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("open log file failed: %s", err.Error())
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("stat log file failed: %s", err.Error())
+	}
+
+	w.file = f
+	w.size = info.Size()
+	w.next = w.conf.period.next(now)
+	if w.conf.symlink && w.conf.period != RotateNone {
+		w.link(filename)
+	}
+
+	return nil
+}
+
+func (w *rotateWriter) rotateLocked(now time.Time, bySize bool) error {
+	filename := w.file.Name()
+	if err := w.closeLocked(); err != nil {
+		return err
+	}
+
+	if bySize {
+		if err := os.Rename(filename, w.backupName(filename)); err != nil {
+			return fmt.Errorf("rename log file failed: %s", err.Error())
+		}
+	}
+	if err := w.openLocked(now); err != nil {
+		return err
+	}
+
+	w.mill()
+	return nil
+}
+
+// backupName 返回当前文件按大小切割后的文件名，序号递增
+func (w *rotateWriter) backupName(filename string) string {
+	stem := strings.TrimSuffix(filename, ".log")
+	for i := 1; ; i++ {
+		name := stem + "." + strconv.Itoa(i) + ".log"
+		if _, err := os.Stat(name); err == nil {
+			continue
+		}
+		if _, err := os.Stat(name + ".gz"); err == nil {
+			continue
+		}
+
+		return name
+	}
+}
+
+// link 将 <name>.log 软链接到当前文件，已存在同名的普通文件时不覆盖
+func (w *rotateWriter) link(filename string) {
+	link := filepath.Join(w.dir, w.name+".log")
+	if info, err := os.Lstat(link); err == nil && info.Mode()&os.ModeSymlink == 0 {
+		return
+	}
+
+	tmp := link + ".tmp"
+	_ = os.Remove(tmp)
+	if err := os.Symlink(filepath.Base(filename), tmp); err != nil {
+		return
+	}
+	_ = os.Rename(tmp, link)
+}
+
+// mill 在后台清理旧文件，不阻塞写日志
+func (w *rotateWriter) mill() {
+	w.millOnce.Do(func() {
+		w.millCh = make(chan struct{}, 1)
+		go func() {
+			for range w.millCh {
+				w.cleanup()
+			}
+		}()
+	})
+
+	select {
+	case w.millCh <- struct{}{}:
+	default:
+	}
+}
+
+type logBackup struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func (w *rotateWriter) cleanup() {
+	w.lock.Lock()
+	conf := w.conf
+	var current string
+	if w.file != nil {
+		current = w.file.Name()
+	}
+	w.lock.Unlock()
+
+	backups, currentSize := w.backups(current)
+
+	var kept []logBackup
+	cutoff := w.now().Add(-conf.maxAge)
+	for i, b := range backups {
+		if (conf.maxBackups > 0 && i >= conf.maxBackups) || (conf.maxAge > 0 && b.modTime.Before(cutoff)) {
+			_ = os.Remove(b.path)
+			continue
+		}
+		kept = append(kept, b)
+	}
+
+	if conf.compress {
+		for i, b := range kept {
+			if strings.HasSuffix(b.path, ".gz") {
+				continue
+			}
+			if size, err := compressLogFile(b.path); err == nil {
+				kept[i].path, kept[i].size = b.path+".gz", size
+			}
+		}
+	}
+
+	if conf.maxTotalSize > 0 {
+		total := currentSize
+		for _, b := range kept {
+			total += b.size
+		}
+		// 从最旧的文件开始删除，当前文件不删除
+		for i := len(kept) - 1; i >= 0 && total > conf.maxTotalSize; i-- {
+			if err := os.Remove(kept[i].path); err == nil {
+				total -= kept[i].size
+			}
+		}
+	}
+}
+
+// backups 返回旧的日志文件，按修改时间从新到旧排序，以及当前文件的大小
+func (w *rotateWriter) backups(current string) ([]logBackup, int64) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, 0
+	}
+
+	var backups []logBackup
+	var currentSize int64
+	for _, e := range entries {
+		if e.IsDir() || !w.backupRe.MatchString(e.Name()) || e.Type()&os.ModeSymlink != 0 {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+
+		path := filepath.Join(w.dir, e.Name())
+		if path == current {
+			currentSize = info.Size()
+			continue
+		}
+		backups = append(backups, logBackup{path: path, size: info.Size(), modTime: info.ModTime()})
+	}
+
+	sort.Slice(backups, func(i, j int) bool { return backups[i].modTime.After(backups[j].modTime) })
+	return backups, currentSize
+}
+
+func compressLogFile(filename string) (int64, error) {
+	src, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	dst, err := os.OpenFile(filename+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(filename + ".gz")
+		return 0, err
+	}
+
+	// 保留原文件的修改时间，清理时按时间排序
+	_ = os.Chtimes(filename+".gz", info.ModTime(), info.ModTime())
+	_ = os.Remove(filename)
+
+	gzInfo, err := os.Stat(filename + ".gz")
+	if err != nil {
+		return 0, err
+	}
+
+	return gzInfo.Size(), nil
+}
@@ -0,0 +1,124 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func listLogFiles(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func TestRotateWriterDaily(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2021, 11, 10, 23, 0, 0, 0, time.UTC)
+	w := newRotateWriter(filepath.Join(dir, "app.log"), rotateConfig{period: RotateDaily, maxSize: 10, symlink: true})
+	w.now = func() time.Time { return now }
+	defer w.Close()
+
+	_, err := w.Write([]byte("day1-a\n"))
+	assert.NoError(t, err)
+	// 超过大小后移动为带序号的文件
+	_, err = w.Write([]byte("day1-b\n"))
+	assert.NoError(t, err)
+
+	now = now.Add(2 * time.Hour)
+	_, err = w.Write([]byte("day2\n"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"app-20211110.1.log", "app-20211110.log", "app-20211111.log", "app.log"}, listLogFiles(t, dir))
+	target, err := os.Readlink(filepath.Join(dir, "app.log"))
+	assert.NoError(t, err)
+	assert.Equal(t, "app-20211111.log", target)
+
+	data, err := os.ReadFile(filepath.Join(dir, "app.log"))
+	assert.NoError(t, err)
+	assert.Equal(t, "day2\n", string(data))
+}
+
+func TestRotateWriterRetention(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for i, name := range []string{"app.1.log", "app.2.log", "app.3.log", "app.4.log", "other.log"} {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, make([]byte, 100), 0644))
+		modTime := now.Add(time.Duration(i-10) * time.Hour)
+		assert.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+	old := filepath.Join(dir, "app.0.log")
+	assert.NoError(t, os.WriteFile(old, nil, 0644))
+	assert.NoError(t, os.Chtimes(old, now.AddDate(0, 0, -30), now.AddDate(0, 0, -30)))
+
+	w := newRotateWriter(filepath.Join(dir, "app.log"), rotateConfig{maxAge: 7 * 24 * time.Hour, maxBackups: 3, maxTotalSize: 350})
+	defer w.Close()
+	_, err := w.Write(make([]byte, 100))
+	assert.NoError(t, err)
+
+	w.cleanup()
+	// app.0.log 过期，app.1.log 超出数量，app.2.log 超出总大小，其他文件不受影响
+	assert.Equal(t, []string{"app.3.log", "app.4.log", "app.log", "other.log"}, listLogFiles(t, dir))
+}
+
+func TestRotateWriterCompress(t *testing.T) {
+	dir := t.TempDir()
+	w := newRotateWriter(filepath.Join(dir, "app.log"), rotateConfig{maxSize: 10, compress: true})
+	defer w.Close()
+
+	_, err := w.Write([]byte("first line\n"))
+	assert.NoError(t, err)
+	_, err = w.Write([]byte("second line\n"))
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		names := listLogFiles(t, dir)
+		return len(names) == 2 && names[0] == "app.1.log.gz"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestAcquireRotateSink(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "app.log")
+
+	sink, release := acquireRotateSink(filename, &Options{Config: Config{RotatePeriod: RotateHourly}})
+	w, ok := sink.(*rotateWriter)
+	assert.True(t, ok)
+
+	// 其他 logger 使用同一个文件时共用 sink，不修改其配置
+	shared, sharedRelease := acquireRotateSink(filename, &Options{Config: Config{RotatePeriod: RotateDaily, MaxBackups: 3}})
+	assert.Same(t, w, shared)
+	assert.Equal(t, RotateHourly, w.conf.period)
+
+	_, err := w.Write([]byte("line\n"))
+	assert.NoError(t, err)
+
+	// 释放一个引用不关闭 sink，重复释放无效
+	assert.NoError(t, release.Close())
+	assert.NoError(t, release.Close())
+	assert.NotNil(t, w.file)
+	assert.Same(t, w, rotateSinks[filename].sink)
+
+	assert.NoError(t, sharedRelease.Close())
+	assert.Nil(t, w.file)
+	assert.NotContains(t, rotateSinks, filename)
+
+	// 全部释放后按新的配置创建
+	sink, release = acquireRotateSink(filename, &Options{Config: Config{}})
+	defer release.Close()
+	_, ok = sink.(*logRotationConfig)
+	assert.True(t, ok)
+}
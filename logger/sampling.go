@@ -0,0 +1,263 @@
+package logger
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// 去重时最多跟踪的不同日志条数，超出后新的日志不再去重
+const maxDedupEntries = 10000
+
+type SamplingConfig struct {
+	Enable       bool                      `yaml:"enable"`
+	Tick         int                       `yaml:"tick"`          // 采样周期，单位秒，默认 1
+	Initial      int                       `yaml:"initial"`       // 每个周期内相同级别和内容的日志先全部输出 Initial 条，默认 100
+	Thereafter   int                       `yaml:"thereafter"`    // 之后每 Thereafter 条输出一条，默认 100
+	Levels       map[LogLevel]SamplingRule `yaml:"levels"`        // 按级别覆盖 Initial 和 Thereafter
+	SampleErrors bool                      `yaml:"sample_errors"` // 未在 Levels 中指定时，error 及以上级别默认不采样
+	DedupWindow  int                       `yaml:"dedup_window"`  // 单位秒，大于 0 时窗口内相同 logger、级别和内容的日志只输出一次，之后输出重复次数的汇总
+}
+
+type SamplingRule struct {
+	Initial    int `yaml:"initial"`
+	Thereafter int `yaml:"thereafter"`
+}
+
+// wrapCore 按配置为 core 加上采样和去重
+func (c *SamplingConfig) wrapCore(core zapcore.Core) zapcore.Core {
+	if c.Enable {
+		core = c.sampler(core)
+	}
+	if c.DedupWindow > 0 {
+		core = newDedupCore(core, time.Duration(c.DedupWindow)*time.Second)
+	}
+
+	return core
+}
+
+// sampler 采样参数相同的级别共用一个 sampler，不采样的级别直接输出
+func (c *SamplingConfig) sampler(core zapcore.Core) zapcore.Core {
+	tick := time.Duration(c.Tick) * time.Second
+	if tick <= 0 {
+		tick = time.Second
+	}
+	defaultRule := SamplingRule{Initial: c.Initial, Thereafter: c.Thereafter}
+	if defaultRule.Initial <= 0 {
+		defaultRule.Initial = 100
+	}
+	if defaultRule.Thereafter <= 0 {
+		defaultRule.Thereafter = 100
+	}
+
+	var exempt levelSet
+	rules := make(map[SamplingRule]levelSet)
+	for l := zapcore.DebugLevel; l <= zapcore.FatalLevel; l++ {
+		rule, ok := c.Levels[LogLevel(l.String())]
+		if !ok {
+			if l >= zapcore.ErrorLevel && !c.SampleErrors {
+				exempt = exempt.add(l)
+				continue
+			}
+			rule = defaultRule
+		}
+		if rule.Initial <= 0 {
+			rule.Initial = defaultRule.Initial
+		}
+		if rule.Thereafter <= 0 {
+			rule.Thereafter = defaultRule.Thereafter
+		}
+		rules[rule] = rules[rule].add(l)
+	}
+
+	var cores []zapcore.Core
+	if exempt != 0 {
+		cores = append(cores, &levelCore{Core: core, level: exempt})
+	}
+	for rule, levels := range rules {
+		cores = append(cores, zapcore.NewSamplerWithOptions(&levelCore{Core: core, level: levels}, tick, rule.Initial, rule.Thereafter))
+	}
+
+	if len(cores) == 1 {
+		return cores[0]
+	}
+
+	return zapcore.NewTee(cores...)
+}
+
+// levelSet 以位图表示一组日志级别
+type levelSet uint16
+
+func (s levelSet) add(l zapcore.Level) levelSet {
+	return s | 1<<uint(l-zapcore.DebugLevel)
+}
+
+func (s levelSet) Enabled(l zapcore.Level) bool {
+	return l >= zapcore.DebugLevel && s&(1<<uint(l-zapcore.DebugLevel)) != 0
+}
+
+// dedupCore 窗口内相同 logger 名、级别和内容的日志只输出第一条，窗口结束或 Sync 时输出一条重复次数的汇总。
+// 通过 With 派生的 core 共享去重状态，汇总写入第一条日志所在的 core，dpanic 及以上级别不去重。
+type dedupCore struct {
+	zapcore.Core
+	state *dedupState
+}
+
+type dedupState struct {
+	lock    sync.Mutex
+	window  time.Duration
+	entries map[uint64]*dedupEntry
+	swept   time.Time
+	timer   *time.Timer // 有未输出的汇总时定时输出
+}
+
+type dedupEntry struct {
+	ent   zapcore.Entry
+	core  zapcore.Core // 第一条日志所在的 core，带有其 With 的字段
+	count int
+}
+
+func newDedupCore(core zapcore.Core, window time.Duration) zapcore.Core {
+	return &dedupCore{Core: core, state: &dedupState{window: window, entries: make(map[uint64]*dedupEntry)}}
+}
+
+func (c *dedupCore) With(fields []zapcore.Field) zapcore.Core {
+	return &dedupCore{Core: c.Core.With(fields), state: c.state}
+}
+
+func (c *dedupCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(ent.Level) {
+		return ce
+	}
+	if ent.Level >= zapcore.DPanicLevel || !c.state.record(c.Core, ent) {
+		return c.Core.Check(ent, ce)
+	}
+
+	return ce
+}
+
+// Sync 先输出所有未输出的汇总
+func (c *dedupCore) Sync() error {
+	c.state.flush()
+
+	return c.Core.Sync()
+}
+
+// record 记录日志，返回 true 表示在窗口内重复，应该丢弃
+func (s *dedupState) record(core zapcore.Core, ent zapcore.Entry) bool {
+	key := entryHash(ent)
+
+	s.lock.Lock()
+	var summaries []dedupEntry
+	if ent.Time.Sub(s.swept) >= s.window || len(s.entries) >= maxDedupEntries {
+		summaries = s.sweepLocked(ent.Time)
+	}
+
+	var duplicate bool
+	e, ok := s.entries[key]
+	switch {
+	case ok && ent.Time.Sub(e.ent.Time) < s.window:
+		e.count++
+		duplicate = true
+		if s.timer == nil {
+			s.timer = time.AfterFunc(s.window, s.flushExpired)
+		}
+	case ok:
+		if e.count > 0 {
+			summaries = append(summaries, *e)
+		}
+		s.entries[key] = &dedupEntry{ent: ent, core: core}
+	case len(s.entries) < maxDedupEntries:
+		s.entries[key] = &dedupEntry{ent: ent, core: core}
+	}
+	s.lock.Unlock()
+
+	s.writeSummaries(summaries)
+
+	return duplicate
+}
+
+// sweepLocked 清理过期的记录，返回需要输出汇总的记录
+func (s *dedupState) sweepLocked(now time.Time) []dedupEntry {
+	s.swept = now
+
+	var summaries []dedupEntry
+	for key, e := range s.entries {
+		if now.Sub(e.ent.Time) < s.window {
+			continue
+		}
+		if e.count > 0 {
+			summaries = append(summaries, *e)
+		}
+		delete(s.entries, key)
+	}
+
+	return summaries
+}
+
+// flushExpired 定时输出窗口已结束的汇总，仍有重复的日志时继续定时
+func (s *dedupState) flushExpired() {
+	s.lock.Lock()
+	s.timer = nil
+	summaries := s.sweepLocked(time.Now())
+	for _, e := range s.entries {
+		if e.count > 0 {
+			s.timer = time.AfterFunc(s.window, s.flushExpired)
+			break
+		}
+	}
+	s.lock.Unlock()
+
+	s.writeSummaries(summaries)
+}
+
+// flush 输出所有的汇总，窗口未结束的记录继续去重
+func (s *dedupState) flush() {
+	s.lock.Lock()
+	var summaries []dedupEntry
+	for _, e := range s.entries {
+		if e.count > 0 {
+			summaries = append(summaries, *e)
+			e.count = 0
+		}
+	}
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.lock.Unlock()
+
+	s.writeSummaries(summaries)
+}
+
+func (s *dedupState) writeSummaries(summaries []dedupEntry) {
+	for _, e := range summaries {
+		ent := e.ent
+		ent.Message = fmt.Sprintf("%s (repeated %d times in %s)", ent.Message, e.count, s.window)
+		ent.Time = time.Now()
+
+		// 经过 Check 而不是直接 Write，避免 Tee 时写入所有的 core
+		if ce := e.core.Check(ent, nil); ce != nil {
+			ce.Write()
+		}
+	}
+}
+
+// entryHash FNV-1a，不产生内存分配
+func entryHash(ent zapcore.Entry) uint64 {
+	const prime = 1099511628211
+	h := uint64(14695981039346656037)
+	h = (h ^ uint64(ent.Level+2)) * prime
+	for i := 0; i < len(ent.LoggerName); i++ {
+		h = (h ^ uint64(ent.LoggerName[i])) * prime
+	}
+	// 分隔 logger 名和内容
+	h = (h ^ 0xff) * prime
+	for i := 0; i < len(ent.Message); i++ {
+		h = (h ^ uint64(ent.Message[i])) * prime
+	}
+
+	return h
+}
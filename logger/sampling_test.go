@@ -0,0 +1,130 @@
+package logger
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func newBufferCore() (zapcore.Core, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	encoderConf := zap.NewProductionEncoderConfig()
+	encoderConf.TimeKey = ""
+	encoderConf.LevelKey = ""
+
+	return zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConf), zapcore.AddSync(buf), zapcore.DebugLevel), buf
+}
+
+func TestSampling(t *testing.T) {
+	core, buf := newBufferCore()
+	c := &SamplingConfig{Enable: true, Initial: 2, Thereafter: 1000, Levels: map[LogLevel]SamplingRule{"debug": {Initial: 1}}}
+	l := zap.New(c.wrapCore(core))
+
+	for i := 0; i < 10; i++ {
+		l.Debug("debug")
+		l.Info("info")
+		l.Error("error")
+	}
+
+	assert.Equal(t, 1, strings.Count(buf.String(), "debug"))
+	assert.Equal(t, 2, strings.Count(buf.String(), "info"))
+	// error 级别默认不采样
+	assert.Equal(t, 10, strings.Count(buf.String(), "error"))
+
+	buf.Reset()
+	c.SampleErrors = true
+	l = zap.New(c.wrapCore(core))
+	for i := 0; i < 10; i++ {
+		l.Error("error")
+	}
+	assert.Equal(t, 2, strings.Count(buf.String(), "error"))
+}
+
+func TestDedup(t *testing.T) {
+	core, buf := newBufferCore()
+	c := &SamplingConfig{DedupWindow: 1}
+	dedup := c.wrapCore(core).With([]zapcore.Field{zap.String("module", "kafka")})
+
+	write := func(msg string, at time.Time) {
+		ent := zapcore.Entry{Level: zapcore.ErrorLevel, Message: msg, Time: at}
+		if ce := dedup.Check(ent, nil); ce != nil {
+			ce.Write()
+		}
+	}
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		write("broker down", now.Add(time.Duration(i)*100*time.Millisecond))
+	}
+	write("other", now)
+	assert.Equal(t, "broker down\t{\"module\": \"kafka\"}\nother\t{\"module\": \"kafka\"}\n", buf.String())
+
+	buf.Reset()
+	write("broker down", now.Add(2*time.Second))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[0], "broker down (repeated 4 times in 1s)")
+	assert.Contains(t, lines[1], "broker down")
+}
+
+// lockedBuffer 定时输出汇总时在其他协程写入
+type lockedBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+func TestDedupFlush(t *testing.T) {
+	buf := &lockedBuffer{}
+	encoderConf := zap.NewProductionEncoderConfig()
+	encoderConf.TimeKey = ""
+	encoderConf.LevelKey = ""
+	core := zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConf), zapcore.AddSync(buf), zapcore.DebugLevel)
+
+	dedup := newDedupCore(core, 50*time.Millisecond)
+	l := zap.New(dedup)
+	kafka := l.With(zap.String("module", "kafka"))
+	redis := l.With(zap.String("module", "redis"))
+
+	// 汇总写入第一条日志所在的 core
+	kafka.Error("connection refused")
+	redis.Error("connection refused")
+	redis.Error("connection refused")
+	// logger 名不同时不去重
+	l.Named("etcd").Error("connection refused")
+	assert.Equal(t, 2, strings.Count(buf.String(), "connection refused"))
+
+	assert.Eventually(t, func() bool {
+		return strings.Contains(buf.String(), "connection refused (repeated 2 times in 50ms)\t{\"module\": \"kafka\"}")
+	}, time.Second, 10*time.Millisecond)
+
+	// Sync 时输出窗口内的汇总
+	dedup = newDedupCore(core, time.Hour)
+	l = zap.New(dedup)
+	l.Warn("slow query")
+	l.Warn("slow query")
+	assert.NotContains(t, buf.String(), "slow query (repeated")
+	assert.NoError(t, l.Sync())
+	assert.Contains(t, buf.String(), "slow query (repeated 1 times in 1h0m0s)")
+
+	// 已输出的重复次数不再输出
+	assert.NoError(t, l.Sync())
+	assert.Equal(t, 1, strings.Count(buf.String(), "slow query (repeated"))
+}
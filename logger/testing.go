@@ -0,0 +1,24 @@
+package logger
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// NewTestLogger 创建记录全部级别日志的 logger 并设为默认 logger，测试结束后恢复。
+// 返回的 ObservedLogs 用于断言输出的日志，替换了全局的 DefaultLog，不能用于并行的测试。
+func NewTestLogger(t testing.TB) (*DemoLog, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+
+	l := &DemoLog{config: &zap.Config{Level: zap.NewAtomicLevelAt(zapcore.DebugLevel)}}
+	l.setBase(zap.New(core, zap.AddCaller()))
+
+	prev := DefaultLog
+	SetDefault(l)
+	t.Cleanup(func() { SetDefault(prev) })
+
+	return l, logs
+}
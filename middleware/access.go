@@ -0,0 +1,213 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessPolicy 访问策略，按 IP 和凭证控制访问，零值不做任何限制
+type AccessPolicy struct {
+	Allow        []string          `yaml:"allow"`         // 允许访问的 IP 或 CIDR，为空时不限制
+	Deny         []string          `yaml:"deny"`          // 禁止访问的 IP 或 CIDR，优先于 Allow
+	BasicAuth    map[string]string `yaml:"basic_auth"`    // basic auth 的用户名和密码
+	BearerTokens []string          `yaml:"bearer_tokens"` // 允许的 bearer token
+}
+
+// AccessConfig 按读写区分的访问控制配置，非 GET/HEAD 请求以及 WritePaths 下的请求使用 Write 策略
+type AccessConfig struct {
+	TrustedProxies []string     `yaml:"trusted_proxies"` // 可信代理的 IP 或 CIDR，来自可信代理的请求以 X-Forwarded-For 确定客户端 IP
+	Read           AccessPolicy `yaml:"read"`
+	Write          AccessPolicy `yaml:"write"`
+	WritePaths     []string     `yaml:"write_paths"` // 按写策略处理的路径前缀，默认为 /debug/pprof 和 /log/level
+}
+
+var defaultWritePaths = []string{"/debug/pprof", "/log/level"}
+
+type accessPolicy struct {
+	allow  []*net.IPNet
+	deny   []*net.IPNet
+	basic  map[string]string
+	tokens []string
+}
+
+func (p *accessPolicy) requireAuth() bool {
+	return len(p.basic) > 0 || len(p.tokens) > 0
+}
+
+func (p *accessPolicy) allowIP(ip net.IP) bool {
+	if ip == nil {
+		return len(p.allow) == 0 && len(p.deny) == 0
+	}
+
+	if containsIP(p.deny, ip) {
+		return false
+	}
+
+	return len(p.allow) == 0 || containsIP(p.allow, ip)
+}
+
+func (p *accessPolicy) authorized(r *http.Request) bool {
+	if user, password, ok := r.BasicAuth(); ok {
+		expect, exist := p.basic[user]
+		return exist && subtle.ConstantTimeCompare([]byte(expect), []byte(password)) == 1
+	}
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+
+	token := []byte(strings.TrimPrefix(auth, "Bearer "))
+	for _, t := range p.tokens {
+		if subtle.ConstantTimeCompare([]byte(t), token) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AccessControl 根据 AccessConfig 限制访问，一般用于 admin 服务。
+// IP 不满足策略时返回 403，需要凭证而凭证缺失或错误时返回 401。
+func AccessControl(conf AccessConfig) (gin.HandlerFunc, error) {
+	trusted, err := parseCIDRs(conf.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %s", err.Error())
+	}
+
+	read, err := newAccessPolicy(conf.Read)
+	if err != nil {
+		return nil, fmt.Errorf("invalid read policy: %s", err.Error())
+	}
+
+	write, err := newAccessPolicy(conf.Write)
+	if err != nil {
+		return nil, fmt.Errorf("invalid write policy: %s", err.Error())
+	}
+
+	writePaths := conf.WritePaths
+	if len(writePaths) == 0 {
+		writePaths = defaultWritePaths
+	}
+
+	return func(c *gin.Context) {
+		policy := read
+		if isWriteRequest(c.Request, writePaths) {
+			policy = write
+		}
+
+		if !policy.allowIP(clientIP(c.Request, trusted)) {
+			abortWithResponse(c, http.StatusForbidden, "access denied")
+			return
+		}
+
+		if policy.requireAuth() && !policy.authorized(c.Request) {
+			if len(policy.basic) > 0 {
+				c.Header("WWW-Authenticate", `Basic realm="admin"`)
+			}
+			abortWithResponse(c, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		c.Next()
+	}, nil
+}
+
+func newAccessPolicy(p AccessPolicy) (*accessPolicy, error) {
+	allow, err := parseCIDRs(p.Allow)
+	if err != nil {
+		return nil, err
+	}
+
+	deny, err := parseCIDRs(p.Deny)
+	if err != nil {
+		return nil, err
+	}
+
+	return &accessPolicy{allow: allow, deny: deny, basic: p.BasicAuth, tokens: p.BearerTokens}, nil
+}
+
+func isWriteRequest(r *http.Request, writePaths []string) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return true
+	}
+
+	for _, p := range writePaths {
+		if strings.HasPrefix(r.URL.Path, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIP 取 RemoteAddr，来自可信代理时从右向左跳过 X-Forwarded-For 中的可信代理，取第一个不可信的地址。
+// gin 只在 Engine.Run 中初始化可信代理，这里不依赖 c.ClientIP()
+func clientIP(r *http.Request, trusted []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(r.RemoteAddr))
+	if err != nil {
+		host = strings.TrimSpace(r.RemoteAddr)
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !containsIP(trusted, ip) {
+		return ip
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+
+		ip = hop
+		if !containsIP(trusted, hop) {
+			break
+		}
+	}
+
+	return ip
+}
+
+func parseCIDRs(list []string) ([]*net.IPNet, error) {
+	res := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", s)
+			}
+
+			if ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, ipNet)
+	}
+
+	return res, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
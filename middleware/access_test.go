@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessControl(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	access, err := AccessControl(AccessConfig{
+		TrustedProxies: []string{"10.0.0.1"},
+		Read:           AccessPolicy{Allow: []string{"192.168.0.0/16", "10.0.0.0/8"}, Deny: []string{"192.168.1.0/24"}},
+		Write:          AccessPolicy{Allow: []string{"10.0.0.0/8"}, BearerTokens: []string{"t0ken"}},
+	})
+	assert.NoError(t, err)
+
+	r := gin.New()
+	r.Use(access)
+	r.GET("/metrics", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	r.GET("/debug/pprof/heap", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	r.PUT("/log/level/update", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	cases := []struct {
+		method, path, remote, forwarded, token string
+		code                                   int
+	}{
+		{"GET", "/metrics", "192.168.2.3:1234", "", "", http.StatusOK},
+		{"GET", "/metrics", "192.168.1.3:1234", "", "", http.StatusForbidden},
+		{"GET", "/metrics", "172.16.0.1:1234", "", "", http.StatusForbidden},
+		// 不可信的来源伪造 X-Forwarded-For 无效
+		{"GET", "/metrics", "172.16.0.1:1234", "192.168.2.3", "", http.StatusForbidden},
+		{"GET", "/metrics", "10.0.0.1:1234", "172.16.0.1, 192.168.2.3", "", http.StatusOK},
+		{"GET", "/metrics", "10.0.0.1:1234", "192.168.1.3", "", http.StatusForbidden},
+		{"GET", "/debug/pprof/heap", "192.168.2.3:1234", "", "t0ken", http.StatusForbidden},
+		{"GET", "/debug/pprof/heap", "10.1.1.1:1234", "", "", http.StatusUnauthorized},
+		{"GET", "/debug/pprof/heap", "10.1.1.1:1234", "", "wrong", http.StatusUnauthorized},
+		{"GET", "/debug/pprof/heap", "10.1.1.1:1234", "", "t0ken", http.StatusOK},
+		{"PUT", "/log/level/update", "10.1.1.1:1234", "", "t0ken", http.StatusOK},
+	}
+
+	for _, cs := range cases {
+		req := httptest.NewRequest(cs.method, cs.path, nil)
+		req.RemoteAddr = cs.remote
+		if cs.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", cs.forwarded)
+		}
+		if cs.token != "" {
+			req.Header.Set("Authorization", "Bearer "+cs.token)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, cs.code, w.Code, "%s %s from %s(%s)", cs.method, cs.path, cs.remote, cs.forwarded)
+	}
+
+	_, err = AccessControl(AccessConfig{Read: AccessPolicy{Allow: []string{"not-an-ip"}}})
+	assert.Error(t, err)
+}
+
+func TestAccessControlBasicAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	access, err := AccessControl(AccessConfig{Write: AccessPolicy{BasicAuth: map[string]string{"admin": "pass"}}})
+	assert.NoError(t, err)
+
+	r := gin.New()
+	r.Use(access)
+	r.PUT("/log/level/update", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	req := httptest.NewRequest(http.MethodPut, "/log/level/update", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Basic realm="admin"`, w.Header().Get("WWW-Authenticate"))
+
+	req.SetBasicAuth("admin", "pass")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maxliu9403/common/gadget"
+	"github.com/maxliu9403/common/logger"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	RequestIDHeader = "X-Request-Id"
+	RequestIDKey    = "request_id"
+)
+
+type accessLogOptions struct {
+	skipPaths   map[string]bool
+	statusLevel map[int]zapcore.Level
+	sampleRate  float64
+}
+
+// AccessLogOption 用于定制 AccessLog 中间件
+type AccessLogOption func(*accessLogOptions)
+
+// AccessLogSkipPaths 不记录这些路径的访问日志，例如 /ping、/metrics
+func AccessLogSkipPaths(paths ...string) AccessLogOption {
+	return func(o *accessLogOptions) {
+		for _, p := range paths {
+			o.skipPaths[p] = true
+		}
+	}
+}
+
+// AccessLogStatusLevel 指定状态码对应的日志级别，
+// 默认 5xx 为 error，4xx 为 warn，其余为 info
+func AccessLogStatusLevel(level zapcore.Level, codes ...int) AccessLogOption {
+	return func(o *accessLogOptions) {
+		for _, code := range codes {
+			o.statusLevel[code] = level
+		}
+	}
+}
+
+// AccessLogSampleRate warn 以下级别日志的采样率，取值 0~1，默认全部记录
+func AccessLogSampleRate(rate float64) AccessLogOption {
+	return func(o *accessLogOptions) { o.sampleRate = rate }
+}
+
+// AccessLog 通过 logger 输出结构化的访问日志，取代 GinFormatterLog。
+// 请求头没有 X-Request-Id 时会生成一个，并写入响应头和 c.Keys 的 request_id。
+// request_id、method、route、client_ip、operator 会通过 logger.WithContext 附加到请求的日志字段中。
+func AccessLog(opts ...AccessLogOption) gin.HandlerFunc {
+	o := &accessLogOptions{
+		skipPaths:   make(map[string]bool),
+		statusLevel: make(map[int]zapcore.Level),
+		sampleRate:  1,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+
+		requestID := c.GetHeader(RequestIDHeader)
+		if requestID == "" {
+			requestID = gadget.UUID()
+			c.Request.Header.Set(RequestIDHeader, requestID)
+		}
+		c.Set(RequestIDKey, requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		// 之后通过 logger.FromContext 和 *WithTrace 输出的日志都带上这些字段
+		ctxFields := []interface{}{RequestIDKey, requestID, "method", c.Request.Method, "route", c.FullPath(), "client_ip", c.ClientIP()}
+		if operator := getRequestUser(c.Request.Header); operator != "" {
+			ctxFields = append(ctxFields, "operator", operator)
+		}
+		logger.WithContext(c, ctxFields...)
+
+		c.Next()
+
+		if o.skipPaths[path] {
+			return
+		}
+
+		status := c.Writer.Status()
+		level := o.level(status)
+		if level < zapcore.WarnLevel && !sampleHit(o.sampleRate) {
+			return
+		}
+
+		ce := logger.Default().Desugar().Check(level, "access")
+		if ce == nil {
+			return
+		}
+
+		fields := []zap.Field{
+			zap.String("method", c.Request.Method),
+			zap.String("path", path),
+			zap.String("route", c.FullPath()),
+			zap.String("query", c.Request.URL.RawQuery),
+			zap.Int("status", status),
+			zap.Duration("latency", time.Since(start)),
+			zap.Int("bytes", c.Writer.Size()),
+			zap.String("client_ip", c.ClientIP()),
+			zap.String("user_agent", c.Request.UserAgent()),
+			zap.String("operator", getRequestUser(c.Request.Header)),
+			zap.String(RequestIDKey, requestID),
+		}
+
+		spanData := logger.SpanFields(c)
+		for i := 0; i+1 < len(spanData); i += 2 {
+			fields = append(fields, zap.Any(spanData[i].(string), spanData[i+1]))
+		}
+
+		if errMsg := c.Errors.ByType(gin.ErrorTypePrivate).String(); errMsg != "" {
+			fields = append(fields, zap.String("error", errMsg))
+		}
+
+		ce.Write(fields...)
+	}
+}
+
+func (o *accessLogOptions) level(status int) zapcore.Level {
+	if l, ok := o.statusLevel[status]; ok {
+		return l
+	}
+
+	switch {
+	case status >= http.StatusInternalServerError:
+		return zapcore.ErrorLevel
+	case status >= http.StatusBadRequest:
+		return zapcore.WarnLevel
+	default:
+		return zapcore.InfoLevel
+	}
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maxliu9403/common/gadget"
+	"github.com/maxliu9403/common/logger"
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-client-go"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newAccessLogRouter(opts ...AccessLogOption) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(AccessLog(opts...))
+	for path, status := range map[string]int{"/ok": http.StatusOK, "/bad": http.StatusBadRequest,
+		"/missing": http.StatusNotFound, "/fail": http.StatusInternalServerError, "/ping": http.StatusOK} {
+		status := status
+		r.GET(path, func(c *gin.Context) { c.Status(status) })
+	}
+
+	return r
+}
+
+// accessLogs 取出并清空已记录的日志，只返回访问日志
+func accessLogs(logs *observer.ObservedLogs) []observer.LoggedEntry {
+	var entries []observer.LoggedEntry
+	for _, e := range logs.TakeAll() {
+		if e.Message == "access" {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries
+}
+
+func TestAccessLogLevel(t *testing.T) {
+	_, logs := logger.NewTestLogger(t)
+	r := newAccessLogRouter(AccessLogSkipPaths("/ping"), AccessLogStatusLevel(zapcore.InfoLevel, http.StatusNotFound))
+
+	for path, level := range map[string]zapcore.Level{
+		"/ok":      zapcore.InfoLevel,
+		"/bad":     zapcore.WarnLevel,
+		"/fail":    zapcore.ErrorLevel,
+		"/missing": zapcore.InfoLevel,
+	} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		entries := accessLogs(logs)
+		if assert.Len(t, entries, 1, path) {
+			assert.Equal(t, level, entries[0].Level, path)
+		}
+	}
+
+	// 跳过的路径仍然设置 request id，但不记录日志
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	assert.NotEmpty(t, w.Header().Get(RequestIDHeader))
+	assert.Empty(t, accessLogs(logs))
+}
+
+func TestAccessLogSampleRate(t *testing.T) {
+	_, logs := logger.NewTestLogger(t)
+
+	// 采样率为 0 时只记录 warn 及以上级别
+	r := newAccessLogRouter(AccessLogSampleRate(0))
+	for _, path := range []string{"/ok", "/bad", "/fail"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	entries := accessLogs(logs)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, "/bad", entries[0].ContextMap()["path"])
+		assert.Equal(t, "/fail", entries[1].ContextMap()["path"])
+	}
+
+	r = newAccessLogRouter(AccessLogSampleRate(1))
+	for i := 0; i < 10; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+	}
+	assert.Len(t, accessLogs(logs), 10)
+}
+
+func TestAccessLogFields(t *testing.T) {
+	_, logs := logger.NewTestLogger(t)
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), jaeger.NewNullReporter())
+	defer closer.Close()
+	span := tracer.StartSpan("request")
+	defer span.Finish()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(gadget.SpanCtxKey, opentracing.ContextWithSpan(context.Background(), span))
+	}, AccessLog())
+	r.GET("/orders/:id", func(c *gin.Context) {
+		time.Sleep(5 * time.Millisecond)
+		c.String(http.StatusCreated, "created")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/1?full=true", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "req-1", w.Header().Get(RequestIDHeader))
+
+	entries := accessLogs(logs)
+	if !assert.Len(t, entries, 1) {
+		return
+	}
+	fields := entries[0].ContextMap()
+	jaegerCtx := span.Context().(jaeger.SpanContext)
+	assert.Equal(t, jaegerCtx.TraceID().String(), fields["trace_id"])
+	assert.Equal(t, jaegerCtx.SpanID().String(), fields["span_id"])
+	assert.Equal(t, "req-1", fields[RequestIDKey])
+	assert.Equal(t, int64(http.StatusCreated), fields["status"])
+	assert.Equal(t, "/orders/:id", fields["route"])
+	assert.Equal(t, "/orders/1", fields["path"])
+	assert.Equal(t, "full=true", fields["query"])
+	assert.Equal(t, int64(len("created")), fields["bytes"])
+	assert.GreaterOrEqual(t, fields["latency"], 5*time.Millisecond)
+}
@@ -0,0 +1,327 @@
+package middleware
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maxliu9403/common/kafka"
+	"github.com/maxliu9403/common/logger"
+)
+
+// AuditRecord 一次变更类请求的审计记录
+type AuditRecord struct {
+	Operator   string    `json:"operator"`
+	Method     string    `json:"method"`
+	Route      string    `json:"route"`
+	URI        string    `json:"uri"`
+	Action     string    `json:"action,omitempty"`
+	Params     string    `json:"params"`
+	Client     string    `json:"client"`
+	StatusCode int       `json:"status_code"`
+	Time       time.Time `json:"time"`
+	Latency    int64     `json:"latency_ms"`
+	TraceID    string    `json:"trace_id,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"`
+}
+
+// AuditSink 审计记录的输出
+type AuditSink interface {
+	Write(ctx context.Context, record *AuditRecord) error
+}
+
+// KafkaAuditSink 通过 kafka 异步生产者发送审计记录，以操作人作为消息 key 保证同一用户的记录有序。
+// 记录先放入有界队列再由后台协程发送，队列已满时直接写入 fallback，不会阻塞请求。
+// 发送失败的消息会写入 fallback，建议为审计单独创建一个 AsyncProducer，避免与其他业务的错误混在一起。
+type KafkaAuditSink struct {
+	producer kafka.AsyncProducer
+	topic    string
+	fallback AuditSink
+	queue    chan *AuditRecord
+}
+
+// auditQueueLength KafkaAuditSink 队列的长度
+const auditQueueLength = 1024
+
+var ErrAuditQueueFull = errors.New("audit queue is full")
+
+// NewKafkaAuditSink ctx 结束后停止发送，队列中剩余的记录写入 fallback
+func NewKafkaAuditSink(ctx context.Context, producer kafka.AsyncProducer, topic string, fallback AuditSink) *KafkaAuditSink {
+	s := &KafkaAuditSink{producer: producer, topic: topic, fallback: fallback, queue: make(chan *AuditRecord, auditQueueLength)}
+	go s.run(ctx)
+	if fallback != nil {
+		go s.spoolErrors(ctx)
+	}
+
+	return s
+}
+
+func (s *KafkaAuditSink) Write(ctx context.Context, record *AuditRecord) error {
+	select {
+	case s.queue <- record:
+		return nil
+	default:
+	}
+
+	if s.fallback == nil {
+		return ErrAuditQueueFull
+	}
+
+	return s.fallback.Write(ctx, record)
+}
+
+func (s *KafkaAuditSink) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case record := <-s.queue:
+					s.spool(ctx, record, ctx.Err())
+				default:
+					return
+				}
+			}
+		case record := <-s.queue:
+			if err := s.produce(record); err != nil {
+				s.spool(ctx, record, err)
+			}
+		}
+	}
+}
+
+func (s *KafkaAuditSink) produce(record *AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if record.Operator == "" {
+		return s.producer.Produce(s.topic, data)
+	}
+
+	return s.producer.Produce(s.topic, data, record.Operator)
+}
+
+// spool 把未能发送的记录写入 fallback，没有 fallback 时只记录日志
+func (s *KafkaAuditSink) spool(ctx context.Context, record *AuditRecord, cause error) {
+	if s.fallback != nil {
+		if cause = s.fallback.Write(ctx, record); cause == nil {
+			return
+		}
+	}
+
+	data, _ := json.Marshal(record)
+	logger.Errorf("audit: spool record failed: %s, record: %s", cause.Error(), string(data))
+}
+
+func (s *KafkaAuditSink) spoolErrors(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case fail := <-s.producer.ProducerErrors():
+			if fail == nil || fail.Msg == nil || fail.Msg.Topic != s.topic {
+				continue
+			}
+
+			data, err := fail.Msg.Value.Encode()
+			if err != nil {
+				continue
+			}
+
+			var record AuditRecord
+			if err = json.Unmarshal(data, &record); err != nil {
+				continue
+			}
+
+			if err = s.fallback.Write(ctx, &record); err != nil {
+				logger.Errorf("audit: spool record failed: %s, record: %s", err.Error(), string(data))
+			}
+		}
+	}
+}
+
+// FileAuditSink 以 JSON Lines 格式追加写入本地文件，用作 kafka 不可用时的兜底
+type FileAuditSink struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileAuditSink{file: f}, nil
+}
+
+func (s *FileAuditSink) Write(_ context.Context, record *AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+func (s *FileAuditSink) Close() error {
+	return s.file.Close()
+}
+
+// FallbackAuditSink primary 写入失败时写入 fallback
+type FallbackAuditSink struct {
+	primary  AuditSink
+	fallback AuditSink
+}
+
+func NewFallbackAuditSink(primary, fallback AuditSink) *FallbackAuditSink {
+	return &FallbackAuditSink{primary: primary, fallback: fallback}
+}
+
+func (s *FallbackAuditSink) Write(ctx context.Context, record *AuditRecord) error {
+	if err := s.primary.Write(ctx, record); err != nil {
+		logger.Warnf("audit: write to primary sink failed: %s, use fallback", err.Error())
+		return s.fallback.Write(ctx, record)
+	}
+
+	return nil
+}
+
+// MemoryAuditSink 保存在内存中，用于单元测试
+type MemoryAuditSink struct {
+	lock    sync.Mutex
+	records []AuditRecord
+}
+
+func (s *MemoryAuditSink) Write(_ context.Context, record *AuditRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.records = append(s.records, *record)
+	return nil
+}
+
+func (s *MemoryAuditSink) Records() []AuditRecord {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]AuditRecord{}, s.records...)
+}
+
+type auditOptions struct {
+	methods     map[string]bool
+	interceptor []InterceptorOption
+}
+
+// AuditOption 用于定制 Audit 中间件
+type AuditOption func(*auditOptions)
+
+// AuditMethods 需要审计的请求方法，默认 POST、PUT、PATCH、DELETE
+func AuditMethods(methods ...string) AuditOption {
+	return func(o *auditOptions) {
+		o.methods = make(map[string]bool)
+		for _, m := range methods {
+			o.methods[strings.ToUpper(m)] = true
+		}
+	}
+}
+
+// AuditParams 定制参数的采集方式，如最大长度、脱敏字段等，与拦截器的选项一致
+func AuditParams(opts ...InterceptorOption) AuditOption {
+	return func(o *auditOptions) { o.interceptor = append(o.interceptor, opts...) }
+}
+
+// Audit 为变更类请求生成审计记录并写入 sink，参数的采集与脱敏与 GinInterceptor 相同。
+// 操作人优先取 X-Forwarded-User，其次取 Authorization 中 JWT 的 sub（不校验签名，校验应由认证中间件完成）。
+func Audit(sink AuditSink, opts ...AuditOption) gin.HandlerFunc {
+	o := &auditOptions{}
+	AuditMethods("POST", "PUT", "PATCH", "DELETE")(o)
+	for _, opt := range opts {
+		opt(o)
+	}
+	capture := newInterceptorOptions(o.interceptor)
+
+	return func(c *gin.Context) {
+		if !o.methods[c.Request.Method] {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		record := &AuditRecord{
+			Operator: auditOperator(c),
+			Method:   c.Request.Method,
+			Route:    c.FullPath(),
+			URI:      c.Request.URL.Path,
+			Action:   requestAction(c),
+			Params:   capture.captureParams(c),
+			Client:   c.ClientIP(),
+			Time:     start,
+		}
+
+		// handler panic 时同样写入审计记录，状态码记为 500
+		panicked := true
+		defer func() {
+			record.StatusCode = c.Writer.Status()
+			if panicked {
+				record.StatusCode = http.StatusInternalServerError
+			}
+			record.Latency = time.Since(start).Milliseconds()
+			record.RequestID = c.GetString(RequestIDKey)
+			record.TraceID = requestTraceID(c)
+
+			if err := sink.Write(c, record); err != nil {
+				logger.ErrorfWithTrace(c, "audit: write record failed: %s", err.Error())
+			}
+		}()
+
+		c.Next()
+		panicked = false
+	}
+}
+
+func auditOperator(c *gin.Context) string {
+	if user := getRequestUser(c.Request.Header); user != "" {
+		return user
+	}
+
+	auth := c.GetHeader("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return ""
+	}
+
+	parts := strings.Split(strings.TrimPrefix(auth, "Bearer "), ".")
+	if len(parts) != 3 {
+		return ""
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ""
+	}
+
+	var claims struct {
+		Subject string `json:"sub"`
+	}
+	_ = json.Unmarshal(payload, &claims)
+
+	return claims.Subject
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sink := &MemoryAuditSink{}
+
+	r := gin.New()
+	r.Use(Audit(sink))
+	r.Any("/orders", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"RetCode": 0})
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders", nil))
+	assert.Empty(t, sink.Records())
+
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"alice"}`))
+	req := httptest.NewRequest(http.MethodPost, "/orders?Action=CreateOrder", strings.NewReader(`{"Amount":1,"Password":"x"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer header."+payload+".sign")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	records := sink.Records()
+	assert.Len(t, records, 1)
+	assert.Equal(t, "alice", records[0].Operator)
+	assert.Equal(t, "CreateOrder", records[0].Action)
+	assert.Equal(t, "/orders", records[0].Route)
+	assert.Equal(t, http.StatusOK, records[0].StatusCode)
+	assert.JSONEq(t, `{"Amount":1,"Password":"******"}`, records[0].Params)
+}
+
+func TestAuditPanic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sink := &MemoryAuditSink{}
+
+	r := gin.New()
+	r.Use(Recovery(), Audit(sink))
+	r.POST("/orders", func(c *gin.Context) { panic("boom") })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/orders", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	records := sink.Records()
+	assert.Len(t, records, 1)
+	assert.Equal(t, http.StatusInternalServerError, records[0].StatusCode)
+}
+
+// blockingProducer Produce 一直阻塞，模拟 kafka 生产者队列已满
+type blockingProducer struct {
+	produced chan struct{}
+}
+
+func (p *blockingProducer) RunAsyncProducer() {}
+
+func (p *blockingProducer) Produce(string, []byte, ...string) error {
+	p.produced <- struct{}{}
+	select {}
+}
+
+func (p *blockingProducer) ProducerErrors() <-chan *sarama.ProducerError { return nil }
+
+func (p *blockingProducer) CloseProducer() {}
+
+func (p *blockingProducer) IsRunning() bool { return true }
+
+func TestKafkaAuditSinkQueueFull(t *testing.T) {
+	fallback := &MemoryAuditSink{}
+	producer := &blockingProducer{produced: make(chan struct{}, 1)}
+	sink := NewKafkaAuditSink(context.Background(), producer, "audit", fallback)
+
+	// 第一条记录被后台协程取出并阻塞在 Produce
+	assert.NoError(t, sink.Write(context.Background(), &AuditRecord{Operator: "alice"}))
+	<-producer.produced
+
+	for i := 0; i < auditQueueLength; i++ {
+		assert.NoError(t, sink.Write(context.Background(), &AuditRecord{Operator: "alice"}))
+	}
+	assert.Empty(t, fallback.Records())
+
+	done := make(chan struct{})
+	go func() {
+		assert.NoError(t, sink.Write(context.Background(), &AuditRecord{Operator: "bob"}))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("write blocks when the queue is full")
+	}
+
+	records := fallback.Records()
+	assert.Len(t, records, 1)
+	assert.Equal(t, "bob", records[0].Operator)
+}
@@ -0,0 +1,339 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultMaxBodySize = 4 << 10
+	redactedValue      = "******"
+)
+
+var (
+	// 默认仅采集文本类的请求/响应体，multipart 和二进制内容直接跳过
+	defaultBodyContentTypes = []string{
+		"application/json",
+		"application/x-www-form-urlencoded",
+		"application/xml",
+		"text/",
+	}
+	defaultRedactKeys = []string{"password", "passwd", "token", "access_token", "refresh_token", "secret", "authorization"}
+)
+
+type interceptorOptions struct {
+	isResponse    bool
+	ignoreActions []string
+	maxBodySize   int
+	contentTypes  []string
+	redactKeys    map[string]struct{}
+	redactPaths   map[string]struct{}
+	redactRegexp  *regexp.Regexp
+	sampleRate    float64
+	routeSample   map[string]float64
+}
+
+// InterceptorOption 用于定制拦截器的请求/响应体采集行为
+type InterceptorOption func(*interceptorOptions)
+
+// InterceptResponse 是否记录响应体
+func InterceptResponse(isResponse bool) InterceptorOption {
+	return func(o *interceptorOptions) { o.isResponse = isResponse }
+}
+
+// InterceptIgnoreActions 指定 Action 参数为这些值的请求不采集
+func InterceptIgnoreActions(actions ...string) InterceptorOption {
+	return func(o *interceptorOptions) { o.ignoreActions = append(o.ignoreActions, actions...) }
+}
+
+// InterceptMaxBodySize 请求/响应体最大采集字节数，超出部分被截断，不影响 handler 读取完整请求体
+func InterceptMaxBodySize(size int) InterceptorOption {
+	return func(o *interceptorOptions) {
+		if size > 0 {
+			o.maxBodySize = size
+		}
+	}
+}
+
+// InterceptContentTypes 覆盖允许采集的 Content-Type 前缀列表
+func InterceptContentTypes(types ...string) InterceptorOption {
+	return func(o *interceptorOptions) { o.contentTypes = types }
+}
+
+// InterceptRedactKeys 追加需要脱敏的 key，大小写不敏感，对任意层级生效
+func InterceptRedactKeys(keys ...string) InterceptorOption {
+	return func(o *interceptorOptions) {
+		for _, k := range keys {
+			o.redactKeys[strings.ToLower(k)] = struct{}{}
+		}
+	}
+}
+
+// InterceptRedactPaths 追加需要脱敏的 JSON 路径，如 data.user.mobile，数组下标用 * 表示
+func InterceptRedactPaths(paths ...string) InterceptorOption {
+	return func(o *interceptorOptions) {
+		for _, p := range paths {
+			o.redactPaths[p] = struct{}{}
+		}
+	}
+}
+
+// InterceptSampleRate 全局采样率，取值 0~1，默认全部采集
+func InterceptSampleRate(rate float64) InterceptorOption {
+	return func(o *interceptorOptions) { o.sampleRate = rate }
+}
+
+// InterceptRouteSampleRate 按路由模板（gin 的 FullPath）设置采样率，优先于全局采样率
+func InterceptRouteSampleRate(route string, rate float64) InterceptorOption {
+	return func(o *interceptorOptions) { o.routeSample[route] = rate }
+}
+
+func newInterceptorOptions(opts []InterceptorOption) *interceptorOptions {
+	o := &interceptorOptions{
+		maxBodySize:  defaultMaxBodySize,
+		contentTypes: defaultBodyContentTypes,
+		redactKeys:   make(map[string]struct{}),
+		redactPaths:  make(map[string]struct{}),
+		sampleRate:   1,
+		routeSample:  make(map[string]float64),
+	}
+	InterceptRedactKeys(defaultRedactKeys...)(o)
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	keys := make([]string, 0, len(o.redactKeys))
+	for k := range o.redactKeys {
+		keys = append(keys, regexp.QuoteMeta(k))
+	}
+	// 用于无法完整解析的（被截断的）JSON 文本
+	o.redactRegexp = regexp.MustCompile(fmt.Sprintf(`(?i)("(?:%s)"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]\s]+)`, strings.Join(keys, "|")))
+
+	return o
+}
+
+func (o *interceptorOptions) isIgnored(action string) bool {
+	for _, u := range o.ignoreActions {
+		if action == u {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (o *interceptorOptions) sampled(route string) bool {
+	rate, ok := o.routeSample[route]
+	if !ok {
+		rate = o.sampleRate
+	}
+
+	return sampleHit(rate)
+}
+
+// sampleHit 按 rate 的概率返回 true
+func sampleHit(rate float64) bool {
+	switch {
+	case rate >= 1:
+		return true
+	case rate <= 0:
+		return false
+	default:
+		return rand.Float64() < rate
+	}
+}
+
+func (o *interceptorOptions) allowContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+
+	for _, t := range o.contentTypes {
+		if strings.HasPrefix(mediaType, t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// captureRequestBody 最多读取 maxBodySize 字节用于记录，并把已读取部分拼回请求体，handler 仍能读到完整内容
+func (o *interceptorOptions) captureRequestBody(c *gin.Context) string {
+	if c.Request.Body == nil {
+		return ""
+	}
+
+	contentType := c.Request.Header.Get("Content-Type")
+	if contentType != "" && !o.allowContentType(contentType) {
+		return fmt.Sprintf("[%s body omitted, %d bytes]", contentType, c.Request.ContentLength)
+	}
+
+	body := c.Request.Body
+	captured, _ := io.ReadAll(io.LimitReader(body, int64(o.maxBodySize)+1))
+	c.Request.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(captured), body), Closer: body}
+
+	if len(captured) == 0 {
+		return ""
+	}
+
+	truncated := len(captured) > o.maxBodySize
+	if truncated {
+		captured = captured[:o.maxBodySize]
+	}
+
+	return o.redactBody(captured, truncated)
+}
+
+// captureParams 收集 query、表单参数和请求体，请求体不为空时以请求体为准，结果已脱敏
+func (o *interceptorOptions) captureParams(c *gin.Context) string {
+	_ = c.Request.ParseForm()
+
+	params := make(map[string]interface{})
+	for k, v := range c.Request.Form {
+		params[k] = v
+	}
+	for k, v := range c.Request.PostForm {
+		params[k] = v
+	}
+
+	if body := o.captureRequestBody(c); body != "" {
+		return body
+	}
+
+	return o.redactForm(params)
+}
+
+func (o *interceptorOptions) redactForm(form map[string]interface{}) string {
+	for k := range form {
+		if _, ok := o.redactKeys[strings.ToLower(k)]; ok {
+			form[k] = redactedValue
+		}
+	}
+
+	par, _ := json.Marshal(form)
+	return string(par)
+}
+
+func (o *interceptorOptions) redactBody(body []byte, truncated bool) string {
+	if !truncated {
+		var data interface{}
+		if err := json.Unmarshal(body, &data); err == nil {
+			res, _ := json.Marshal(o.redactJSON(data, ""))
+			return string(res)
+		}
+	}
+
+	res := o.redactRegexp.ReplaceAllString(string(body), fmt.Sprintf(`${1}"%s"`, redactedValue))
+	if truncated {
+		res += "...(truncated)"
+	}
+
+	return res
+}
+
+func (o *interceptorOptions) redactJSON(data interface{}, path string) interface{} {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			p := joinJSONPath(path, k)
+			if o.shouldRedact(k, p) {
+				v[k] = redactedValue
+				continue
+			}
+			v[k] = o.redactJSON(val, p)
+		}
+	case []interface{}:
+		p := joinJSONPath(path, "*")
+		for i := range v {
+			if _, ok := o.redactPaths[p]; ok {
+				v[i] = redactedValue
+				continue
+			}
+			v[i] = o.redactJSON(v[i], p)
+		}
+	}
+
+	return data
+}
+
+func (o *interceptorOptions) shouldRedact(key, path string) bool {
+	if _, ok := o.redactKeys[strings.ToLower(key)]; ok {
+		return true
+	}
+
+	_, ok := o.redactPaths[path]
+	return ok
+}
+
+func joinJSONPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// bodyLogWriter 在写出响应的同时最多缓存 limit 字节用于记录
+type bodyLogWriter struct {
+	gin.ResponseWriter
+	body      *bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func newBodyLogWriter(w gin.ResponseWriter, limit int) *bodyLogWriter {
+	return &bodyLogWriter{ResponseWriter: w, body: bytes.NewBufferString(""), limit: limit}
+}
+
+func (b *bodyLogWriter) Write(bs []byte) (int, error) {
+	b.capture(bs)
+	return b.ResponseWriter.Write(bs)
+}
+
+func (b *bodyLogWriter) WriteString(s string) (int, error) {
+	b.capture([]byte(s))
+	return b.ResponseWriter.WriteString(s)
+}
+
+func (b *bodyLogWriter) capture(bs []byte) {
+	remain := b.limit - b.body.Len()
+	if remain <= 0 {
+		b.truncated = b.truncated || len(bs) > 0
+		return
+	}
+
+	if len(bs) > remain {
+		bs = bs[:remain]
+		b.truncated = true
+	}
+
+	b.body.Write(bs)
+}
+
+func (o *interceptorOptions) responseBody(blw *bodyLogWriter) string {
+	if blw.body.Len() == 0 {
+		return ""
+	}
+
+	contentType := blw.Header().Get("Content-Type")
+	if contentType != "" && !o.allowContentType(contentType) {
+		return fmt.Sprintf("[%s body omitted, %d bytes]", contentType, blw.Size())
+	}
+
+	return o.redactBody(blw.body.Bytes(), blw.truncated)
+}
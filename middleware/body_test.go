@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactBody(t *testing.T) {
+	o := newInterceptorOptions([]InterceptorOption{InterceptRedactPaths("data.items.*.mobile")})
+
+	cases := []struct {
+		body      string
+		truncated bool
+		expect    string
+	}{
+		{`{"name":"a","Password":"123"}`, false, `{"Password":"******","name":"a"}`},
+		{`{"data":{"token":"abc","items":[{"mobile":"138"}]}}`, false, `{"data":{"items":[{"mobile":"******"}],"token":"******"}}`},
+		{`{"name":"a","password":"12`, true, `{"name":"a","password":"******"...(truncated)`},
+		{`{"token": 12345, "name":"a"`, true, `{"token": "******", "name":"a"...(truncated)`},
+		{`plain text`, false, `plain text`},
+	}
+
+	for _, ca := range cases {
+		assert.Equal(t, ca.expect, o.redactBody([]byte(ca.body), ca.truncated))
+	}
+}
+
+func TestCaptureRequestBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	o := newInterceptorOptions([]InterceptorOption{InterceptMaxBodySize(8)})
+
+	body := `{"name":"abcdefg"}`
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	assert.Equal(t, `{"name":...(truncated)`, o.captureRequestBody(c))
+
+	// handler 仍然可以读取到完整的请求体
+	full, err := io.ReadAll(c.Request.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(full))
+
+	c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte{0x1, 0x2}))
+	c.Request.Header.Set("Content-Type", "application/octet-stream")
+	assert.Equal(t, "[application/octet-stream body omitted, 2 bytes]", o.captureRequestBody(c))
+}
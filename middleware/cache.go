@@ -0,0 +1,297 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maxliu9403/common/logger"
+)
+
+const (
+	cacheTagsKey      = "_response_cache_tags"
+	CacheStatusHeader = "X-Cache"
+)
+
+// defaultCacheVaryHeaders 标识用户身份的请求头，默认参与生成缓存 key，避免不同用户共享缓存
+var defaultCacheVaryHeaders = []string{"Authorization", "Cookie", "X-Forwarded-User"}
+
+type cacheOptions struct {
+	prefix      string
+	shared      bool
+	varyHeaders []string
+	tags        []string
+	maxBodySize int
+}
+
+// CacheOption 用于定制 ResponseCache 中间件
+type CacheOption func(*cacheOptions)
+
+// CacheKeyPrefix 指定缓存 key 的前缀
+func CacheKeyPrefix(prefix string) CacheOption {
+	return func(o *cacheOptions) { o.prefix = prefix }
+}
+
+// CacheVaryHeaders 参与生成缓存 key 的请求头，例如 X-Forwarded-User、Accept-Language
+func CacheVaryHeaders(headers ...string) CacheOption {
+	return func(o *cacheOptions) { o.varyHeaders = append(o.varyHeaders, headers...) }
+}
+
+// CacheShared 缓存 key 不包含 Authorization、Cookie、X-Forwarded-User，所有用户共享缓存，只用于与用户无关的响应
+func CacheShared() CacheOption {
+	return func(o *cacheOptions) { o.shared = true }
+}
+
+// CacheTags 为该路由的缓存打上 tag，写操作后通过 CacheStore.InvalidateTags 使其失效
+func CacheTags(tags ...string) CacheOption {
+	return func(o *cacheOptions) { o.tags = append(o.tags, tags...) }
+}
+
+// CacheMaxBodySize 可缓存的最大响应体字节数，超出时直接透传，默认 1MB
+func CacheMaxBodySize(size int) CacheOption {
+	return func(o *cacheOptions) { o.maxBodySize = size }
+}
+
+// AddCacheTags 在 handler 中根据查询结果追加 tag，例如按租户失效
+func AddCacheTags(c *gin.Context, tags ...string) {
+	c.Set(cacheTagsKey, append(c.GetStringSlice(cacheTagsKey), tags...))
+}
+
+type cacheEntry struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+	ETag   string      `json:"etag"`
+}
+
+// ResponseCache 缓存 GET/HEAD 请求的 200 响应，ttl 为该路由的缓存时间，例如
+//
+//	r.GET("/users", middleware.ResponseCache(store, time.Minute, middleware.CacheTags("user")), listUsers)
+//
+// 缓存 key 由路由模板、排序后的查询参数、用户身份相关的请求头（见 CacheShared）和 CacheVaryHeaders 指定的请求头组成。
+// 带有 Set-Cookie 或 Cache-Control: private/no-store 的响应不会被缓存。
+// 响应会带上 ETag，If-None-Match 命中时返回 304；请求头 Cache-Control: no-cache 会跳过缓存读取并刷新缓存，
+// no-store 则既不读取也不写入缓存。
+func ResponseCache(store CacheStore, ttl time.Duration, opts ...CacheOption) gin.HandlerFunc { //nolint:funlen
+	o := &cacheOptions{prefix: "response", maxBodySize: 1 << 20}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if !o.shared {
+		o.varyHeaders = append(append([]string{}, defaultCacheVaryHeaders...), o.varyHeaders...)
+	}
+
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+
+		cacheControl := strings.ToLower(c.GetHeader("Cache-Control"))
+		noStore := strings.Contains(cacheControl, "no-store")
+		noCache := noStore || strings.Contains(cacheControl, "no-cache")
+		key := o.cacheKey(c)
+
+		if !noCache {
+			val, ok, err := store.Get(c, key)
+			if err != nil {
+				logger.WarnfWithTrace(c, "response cache: get %s failed: %s", key, err.Error())
+			}
+
+			var entry cacheEntry
+			if ok && json.Unmarshal(val, &entry) == nil {
+				c.Header(CacheStatusHeader, "HIT")
+				writeCacheEntry(c, &entry)
+				c.Abort()
+				return
+			}
+		}
+
+		cw := &cacheWriter{ResponseWriter: c.Writer, status: http.StatusOK, limit: o.maxBodySize}
+		c.Writer = cw
+		c.Next()
+		c.Writer = cw.ResponseWriter
+
+		if cw.passthrough {
+			return
+		}
+
+		entry := &cacheEntry{Status: cw.status, Header: cw.Header().Clone(), Body: cw.body.Bytes()}
+		if entry.Status != http.StatusOK {
+			writeCacheEntry(c, entry)
+			return
+		}
+
+		sum := sha256.Sum256(entry.Body)
+		entry.ETag = `"` + hex.EncodeToString(sum[:16]) + `"`
+
+		if !noStore && responseCacheable(entry.Header) {
+			data, _ := json.Marshal(entry)
+			tags := append(append([]string{}, o.tags...), c.GetStringSlice(cacheTagsKey)...)
+			if err := store.Set(c, key, data, ttl, tags...); err != nil {
+				logger.WarnfWithTrace(c, "response cache: set %s failed: %s", key, err.Error())
+			}
+		}
+
+		c.Header(CacheStatusHeader, "MISS")
+		writeCacheEntry(c, entry)
+	}
+}
+
+// responseCacheable 响应是否允许写入共享缓存
+func responseCacheable(header http.Header) bool {
+	if len(header.Values("Set-Cookie")) > 0 {
+		return false
+	}
+
+	cacheControl := strings.ToLower(strings.Join(header.Values("Cache-Control"), ","))
+	return !strings.Contains(cacheControl, "private") && !strings.Contains(cacheControl, "no-store")
+}
+
+func (o *cacheOptions) cacheKey(c *gin.Context) string {
+	route := c.FullPath()
+	if route == "" {
+		route = c.Request.URL.Path
+	}
+
+	query := c.Request.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(c.Request.Method + " " + route + " " + c.Request.URL.Path + "?")
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		b.WriteString(k + "=" + strings.Join(values, ",") + "&")
+	}
+	for _, h := range o.varyHeaders {
+		b.WriteString("|" + h + "=" + c.GetHeader(h))
+	}
+
+	sum := sha256.Sum256([]byte(b.String()))
+	return o.prefix + ":" + hex.EncodeToString(sum[:])
+}
+
+func writeCacheEntry(c *gin.Context, entry *cacheEntry) {
+	header := c.Writer.Header()
+	for k, v := range entry.Header {
+		header[k] = v
+	}
+
+	if entry.ETag != "" {
+		header.Set("ETag", entry.ETag)
+		if etagMatch(c.GetHeader("If-None-Match"), entry.ETag) {
+			c.Status(http.StatusNotModified)
+			c.Writer.WriteHeaderNow()
+			return
+		}
+	}
+
+	c.Status(entry.Status)
+	if c.Request.Method == http.MethodHead {
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	_, _ = c.Writer.Write(entry.Body)
+}
+
+func etagMatch(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	for _, t := range strings.Split(ifNoneMatch, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cacheWriter 缓冲响应以便计算 ETag，超出 limit 或 handler 主动 Flush 时转为透传
+type cacheWriter struct {
+	gin.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	limit       int
+	passthrough bool
+}
+
+func (w *cacheWriter) WriteHeader(code int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	w.status = code
+}
+
+func (w *cacheWriter) WriteHeaderNow() {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *cacheWriter) Write(data []byte) (int, error) {
+	if !w.passthrough && w.body.Len()+len(data) > w.limit {
+		w.startPassthrough()
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(data)
+	}
+
+	return w.body.Write(data)
+}
+
+func (w *cacheWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *cacheWriter) Flush() {
+	w.startPassthrough()
+	w.ResponseWriter.Flush()
+}
+
+func (w *cacheWriter) startPassthrough() {
+	if w.passthrough {
+		return
+	}
+
+	w.passthrough = true
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.body.Len() > 0 {
+		_, _ = w.ResponseWriter.Write(w.body.Bytes())
+	}
+}
+
+func (w *cacheWriter) Status() int {
+	if w.passthrough {
+		return w.ResponseWriter.Status()
+	}
+
+	return w.status
+}
+
+func (w *cacheWriter) Size() int {
+	if w.passthrough {
+		return w.ResponseWriter.Size()
+	}
+
+	return w.body.Len()
+}
+
+func (w *cacheWriter) Written() bool {
+	return w.passthrough || w.body.Len() > 0
+}
@@ -0,0 +1,225 @@
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/maxliu9403/common/rediscache"
+)
+
+// CacheStore 响应缓存的存储，handler 在写操作后可调用 InvalidateTags 使相关缓存失效
+type CacheStore interface {
+	Get(ctx context.Context, key string) (val []byte, ok bool, err error)
+	Set(ctx context.Context, key string, val []byte, ttl time.Duration, tags ...string) error
+	InvalidateTags(ctx context.Context, tags ...string) error
+}
+
+type lruEntry struct {
+	key      string
+	val      []byte
+	tags     []string
+	expireAt time.Time
+}
+
+// MemoryCacheStore 进程内的 LRU 缓存
+type MemoryCacheStore struct {
+	lock     sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+	tags     map[string]map[string]struct{}
+}
+
+// NewMemoryCacheStore capacity 为最多缓存的条目数
+func NewMemoryCacheStore(capacity int) *MemoryCacheStore {
+	if capacity <= 0 {
+		capacity = 1024
+	}
+
+	return &MemoryCacheStore{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+		tags:     make(map[string]map[string]struct{}),
+	}
+}
+
+func (m *MemoryCacheStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	ele, ok := m.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	entry := ele.Value.(*lruEntry)
+	if time.Now().After(entry.expireAt) {
+		m.removeElement(ele)
+		return nil, false, nil
+	}
+
+	m.ll.MoveToFront(ele)
+	return entry.val, true, nil
+}
+
+func (m *MemoryCacheStore) Set(_ context.Context, key string, val []byte, ttl time.Duration, tags ...string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if ele, ok := m.items[key]; ok {
+		m.removeElement(ele)
+	}
+
+	entry := &lruEntry{key: key, val: val, tags: tags, expireAt: time.Now().Add(ttl)}
+	m.items[key] = m.ll.PushFront(entry)
+	for _, t := range tags {
+		if m.tags[t] == nil {
+			m.tags[t] = make(map[string]struct{})
+		}
+		m.tags[t][key] = struct{}{}
+	}
+
+	for m.ll.Len() > m.capacity {
+		m.removeElement(m.ll.Back())
+	}
+
+	return nil
+}
+
+func (m *MemoryCacheStore) InvalidateTags(_ context.Context, tags ...string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, t := range tags {
+		for key := range m.tags[t] {
+			if ele, ok := m.items[key]; ok {
+				m.removeElement(ele)
+			}
+		}
+		delete(m.tags, t)
+	}
+
+	return nil
+}
+
+func (m *MemoryCacheStore) removeElement(ele *list.Element) {
+	entry := ele.Value.(*lruEntry)
+	m.ll.Remove(ele)
+	delete(m.items, entry.key)
+
+	for _, t := range entry.tags {
+		if keys, ok := m.tags[t]; ok {
+			delete(keys, entry.key)
+			if len(keys) == 0 {
+				delete(m.tags, t)
+			}
+		}
+	}
+}
+
+// RedisCacheStore 基于 redis 的缓存，tag 对应的 key 保存在 set 中
+type RedisCacheStore struct {
+	cli    *redis.Client
+	prefix string
+}
+
+// NewRedisCacheStore cli 为空时使用 rediscache.GetCli()
+func NewRedisCacheStore(cli *redis.Client, prefix string) *RedisCacheStore {
+	if prefix == "" {
+		prefix = "httpcache"
+	}
+
+	return &RedisCacheStore{cli: cli, prefix: prefix}
+}
+
+func (r *RedisCacheStore) client() (*redis.Client, error) {
+	if r.cli != nil {
+		return r.cli, nil
+	}
+	if cli := rediscache.GetCli(); cli != nil {
+		return cli, nil
+	}
+
+	return nil, fmt.Errorf("redis client is not initialized yet")
+}
+
+func (r *RedisCacheStore) tagKey(tag string) string {
+	return fmt.Sprintf("%s:tag:%s", r.prefix, tag)
+}
+
+func (r *RedisCacheStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	cli, err := r.client()
+	if err != nil {
+		return nil, false, err
+	}
+
+	val, err := cli.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return val, true, nil
+}
+
+func (r *RedisCacheStore) Set(ctx context.Context, key string, val []byte, ttl time.Duration, tags ...string) error {
+	cli, err := r.client()
+	if err != nil {
+		return err
+	}
+
+	_, err = cli.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, val, ttl)
+		for _, t := range tags {
+			// tag 集合比缓存本身多保留一段时间，避免提前过期导致无法失效
+			tagAddScript.Eval(ctx, pipe, []string{r.tagKey(t)}, (2 * ttl).Milliseconds(), key)
+		}
+		return nil
+	})
+
+	return err
+}
+
+// tagAddScript 把 key 加入 tag 集合，集合的过期时间只延长不缩短，
+// 否则短缓存时间的响应会让仍在缓存中的长缓存时间的响应无法按 tag 失效；ARGV[1] 不大于 0 时集合不过期
+var tagAddScript = redis.NewScript(`
+local existed = redis.call('EXISTS', KEYS[1])
+redis.call('SADD', KEYS[1], ARGV[2])
+local want = tonumber(ARGV[1])
+if want <= 0 then
+	return redis.call('PERSIST', KEYS[1])
+end
+local ttl = redis.call('PTTL', KEYS[1])
+if existed == 1 and (ttl == -1 or ttl >= want) then
+	return 0
+end
+return redis.call('PEXPIRE', KEYS[1], ARGV[1])
+`)
+
+func (r *RedisCacheStore) InvalidateTags(ctx context.Context, tags ...string) error {
+	cli, err := r.client()
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tags {
+		keys, err := cli.SMembers(ctx, r.tagKey(t)).Result()
+		if err != nil {
+			return err
+		}
+
+		keys = append(keys, r.tagKey(t))
+		if err = cli.Del(ctx, keys...).Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
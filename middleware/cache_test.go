@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/maxliu9403/common/gadget"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := NewMemoryCacheStore(16)
+	calls := 0
+
+	r := gin.New()
+	r.GET("/users", ResponseCache(store, time.Minute, CacheTags("user")), func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusOK, gin.H{"RetCode": 0, "Page": c.Query("page")})
+	})
+
+	do := func(url string, header map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("/users?page=1&size=10", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "MISS", w.Header().Get(CacheStatusHeader))
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	// 查询参数顺序不影响缓存 key
+	w = do("/users?size=10&page=1", nil)
+	assert.Equal(t, "HIT", w.Header().Get(CacheStatusHeader))
+	assert.JSONEq(t, `{"RetCode":0,"Page":"1"}`, w.Body.String())
+
+	w = do("/users?page=1&size=10", map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w = do("/users?page=1&size=10", map[string]string{"Cache-Control": "no-cache"})
+	assert.Equal(t, "MISS", w.Header().Get(CacheStatusHeader))
+	assert.Equal(t, 2, calls)
+
+	assert.NoError(t, store.InvalidateTags(context.Background(), "user"))
+	w = do("/users?page=1&size=10", nil)
+	assert.Equal(t, "MISS", w.Header().Get(CacheStatusHeader))
+	assert.Equal(t, 3, calls)
+}
+
+func TestMemoryCacheStoreEvict(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryCacheStore(2)
+
+	_ = store.Set(ctx, "a", []byte("a"), time.Minute)
+	_ = store.Set(ctx, "b", []byte("b"), time.Minute)
+	_, _, _ = store.Get(ctx, "a")
+	_ = store.Set(ctx, "c", []byte("c"), time.Minute)
+
+	_, ok, _ := store.Get(ctx, "b")
+	assert.False(t, ok)
+	_, ok, _ = store.Get(ctx, "a")
+	assert.True(t, ok)
+
+	_ = store.Set(ctx, "d", []byte("d"), -time.Second)
+	_, ok, _ = store.Get(ctx, "d")
+	assert.False(t, ok)
+}
+
+func TestResponseCacheIdentity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := NewMemoryCacheStore(16)
+
+	r := gin.New()
+	r.GET("/me", ResponseCache(store, time.Minute), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetHeader("Authorization"))
+	})
+	r.GET("/login", ResponseCache(store, time.Minute), func(c *gin.Context) {
+		c.SetCookie("session", "s1", 60, "/", "", false, true)
+		c.String(http.StatusOK, "ok")
+	})
+	r.GET("/private", ResponseCache(store, time.Minute), func(c *gin.Context) {
+		c.Header("Cache-Control", "private, max-age=60")
+		c.String(http.StatusOK, "ok")
+	})
+	r.GET("/public", ResponseCache(store, time.Minute, CacheShared()), func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	do := func(url, auth string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("Authorization", auth)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 不同用户不共享缓存
+	assert.Equal(t, "MISS", do("/me", "alice").Header().Get(CacheStatusHeader))
+	w := do("/me", "bob")
+	assert.Equal(t, "MISS", w.Header().Get(CacheStatusHeader))
+	assert.Equal(t, "bob", w.Body.String())
+	assert.Equal(t, "HIT", do("/me", "alice").Header().Get(CacheStatusHeader))
+
+	// 带 Set-Cookie 或 Cache-Control: private 的响应不缓存
+	for _, url := range []string{"/login", "/private"} {
+		do(url, "alice")
+		assert.Equal(t, "MISS", do(url, "alice").Header().Get(CacheStatusHeader), url)
+	}
+
+	do("/public", "alice")
+	assert.Equal(t, "HIT", do("/public", "bob").Header().Get(CacheStatusHeader))
+}
+
+func TestRedisCacheStoreTagTTL(t *testing.T) {
+	ctx := context.Background()
+	cli := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379"})
+	defer cli.Close()
+	if err := cli.Ping(ctx).Err(); err != nil {
+		t.Skipf("redis is not available: %s", err.Error())
+	}
+
+	prefix := "httpcache-test:" + gadget.UUID()
+	store := NewRedisCacheStore(cli, prefix)
+	tagKey := store.tagKey("orders")
+	long, short := prefix+":long", prefix+":short"
+	defer cli.Del(ctx, tagKey, long, short)
+
+	assert.NoError(t, store.Set(ctx, long, []byte("long"), 10*time.Minute, "orders"))
+	assert.NoError(t, store.Set(ctx, short, []byte("short"), time.Second, "orders"))
+
+	// 短缓存时间的响应不会缩短 tag 集合的过期时间
+	ttl, err := cli.PTTL(ctx, tagKey).Result()
+	assert.NoError(t, err)
+	assert.Greater(t, ttl, 10*time.Minute)
+
+	assert.NoError(t, store.InvalidateTags(ctx, "orders"))
+	_, ok, err := store.Get(ctx, long)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// 不过期的缓存使 tag 集合也不过期
+	assert.NoError(t, store.Set(ctx, long, []byte("long"), 0, "orders"))
+	assert.NoError(t, store.Set(ctx, short, []byte("short"), time.Second, "orders"))
+	ttl, err = cli.PTTL(ctx, tagKey).Result()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(-1), ttl)
+}
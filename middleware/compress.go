@@ -0,0 +1,348 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+	encodingZstd    = "zstd"
+)
+
+var defaultCompressContentTypes = []string{
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"text/",
+}
+
+type compressOptions struct {
+	level        int
+	minSize      int
+	contentTypes []string
+	excludePaths []string
+	zstd         bool
+}
+
+// CompressOption 用于定制 Compress 中间件
+type CompressOption func(*compressOptions)
+
+// CompressLevel 压缩级别，gzip/deflate 取值 -1~9，zstd 按相同的数值映射到最接近的级别，默认 gzip.DefaultCompression
+func CompressLevel(level int) CompressOption {
+	return func(o *compressOptions) { o.level = level }
+}
+
+// CompressMinSize 响应体达到该字节数才压缩，默认 1KB
+func CompressMinSize(size int) CompressOption {
+	return func(o *compressOptions) { o.minSize = size }
+}
+
+// CompressContentTypes 覆盖允许压缩的 Content-Type 前缀列表
+func CompressContentTypes(types ...string) CompressOption {
+	return func(o *compressOptions) { o.contentTypes = types }
+}
+
+// CompressExcludePaths 不压缩的路径前缀
+func CompressExcludePaths(paths ...string) CompressOption {
+	return func(o *compressOptions) { o.excludePaths = append(o.excludePaths, paths...) }
+}
+
+// CompressZstd 是否启用 zstd，客户端同时支持时优先于 gzip
+func CompressZstd(enable bool) CompressOption {
+	return func(o *compressOptions) { o.zstd = enable }
+}
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// Compress 根据 Accept-Encoding 协商压缩响应，支持 gzip、deflate 和可选的 zstd。
+// 已设置 Content-Encoding、小于最小长度、类型不在允许列表中以及调用过 Flush 的流式响应（如 SSE）不压缩。
+// 与 GinInterceptor 一起使用时，拦截器记录的始终是压缩前的内容；与 ResponseCache 一起使用时应先注册 Compress。
+func Compress(opts ...CompressOption) gin.HandlerFunc {
+	o := &compressOptions{
+		level:        gzip.DefaultCompression,
+		minSize:      1 << 10,
+		contentTypes: defaultCompressContentTypes,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	pools := map[string]*sync.Pool{
+		encodingGzip: {New: func() interface{} {
+			w, err := gzip.NewWriterLevel(io.Discard, o.level)
+			if err != nil {
+				w = gzip.NewWriter(io.Discard)
+			}
+			return w
+		}},
+		// HTTP 的 deflate 是 zlib 格式（RFC 9110），不是裸的 DEFLATE 数据
+		encodingDeflate: {New: func() interface{} {
+			w, err := zlib.NewWriterLevel(io.Discard, o.level)
+			if err != nil {
+				w = zlib.NewWriter(io.Discard)
+			}
+			return w
+		}},
+	}
+	if o.zstd {
+		level := zstd.SpeedDefault
+		if o.level > 0 {
+			level = zstd.EncoderLevelFromZstd(o.level)
+		}
+		pools[encodingZstd] = &sync.Pool{New: func() interface{} {
+			w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(1))
+			return w
+		}}
+	}
+
+	return func(c *gin.Context) {
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"), o.zstd)
+		if encoding == "" || !o.compressible(c.Request) {
+			c.Next()
+			return
+		}
+
+		// 拦截器的 bodyLogWriter 已经在外层时，把压缩放到它的下层，保证记录的是明文
+		outer := c.Writer
+		blw, inner := outer.(*bodyLogWriter)
+		cw := &compressWriter{opts: o, pool: pools[encoding], encoding: encoding, status: http.StatusOK}
+		if inner {
+			cw.ResponseWriter = blw.ResponseWriter
+			blw.ResponseWriter = cw
+		} else {
+			cw.ResponseWriter = outer
+			c.Writer = cw
+		}
+
+		defer func() {
+			cw.close()
+			if inner {
+				blw.ResponseWriter = cw.ResponseWriter
+			} else {
+				c.Writer = outer
+			}
+		}()
+
+		c.Next()
+	}
+}
+
+func (o *compressOptions) compressible(r *http.Request) bool {
+	if r.Method == http.MethodHead || r.Header.Get("Range") != "" || r.Header.Get("Upgrade") != "" ||
+		strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		return false
+	}
+
+	for _, p := range o.excludePaths {
+		if strings.HasPrefix(r.URL.Path, p) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (o *compressOptions) allowContentType(contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	if mediaType == "text/event-stream" {
+		return false
+	}
+
+	for _, t := range o.contentTypes {
+		if strings.HasPrefix(mediaType, t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// negotiateEncoding 按 q 值选择编码，q 值相同时依次优先 zstd、gzip、deflate
+func negotiateEncoding(acceptEncoding string, enableZstd bool) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+
+	candidates := []string{encodingGzip, encodingDeflate}
+	if enableZstd {
+		candidates = append([]string{encodingZstd}, candidates...)
+	}
+
+	weights := make(map[string]float64)
+	wildcard := -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, q := parseEncodingQ(part)
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+		weights[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range candidates {
+		q, ok := weights[enc]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+
+	return best
+}
+
+func parseEncodingQ(part string) (string, float64) {
+	fields := strings.Split(part, ";")
+	name := strings.ToLower(strings.TrimSpace(fields[0]))
+	q := 1.0
+	for _, f := range fields[1:] {
+		f = strings.TrimSpace(f)
+		if strings.HasPrefix(f, "q=") {
+			if v, err := strconv.ParseFloat(strings.TrimPrefix(f, "q="), 64); err == nil {
+				q = v
+			}
+		}
+	}
+
+	return name, q
+}
+
+// compressWriter 先缓存 minSize 字节，根据响应头决定压缩还是透传
+type compressWriter struct {
+	gin.ResponseWriter
+	opts     *compressOptions
+	pool     *sync.Pool
+	encoding string
+	status   int
+	buf      bytes.Buffer
+	decided  bool
+	encoder  encoder
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	w.status = code
+}
+
+func (w *compressWriter) WriteHeaderNow() {
+	if w.decided {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		if w.buf.Len()+len(data) < w.opts.minSize {
+			return w.buf.Write(data)
+		}
+
+		w.decide(true)
+	}
+
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush 流式响应不压缩，尚未开始压缩时直接转为透传
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.encoder != nil {
+		_ = w.encoder.Flush()
+	}
+
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) decide(compress bool) {
+	w.decided = true
+
+	header := w.ResponseWriter.Header()
+	compress = compress && header.Get("Content-Encoding") == "" &&
+		w.status != http.StatusNoContent && w.status != http.StatusNotModified &&
+		w.opts.allowContentType(header.Get("Content-Type"))
+
+	if compress {
+		header.Set("Content-Encoding", w.encoding)
+		header.Add("Vary", "Accept-Encoding")
+		header.Del("Content-Length")
+
+		w.encoder = w.pool.Get().(encoder)
+		w.encoder.Reset(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.buf.Len() == 0 {
+		return
+	}
+
+	if w.encoder != nil {
+		_, _ = w.encoder.Write(w.buf.Bytes())
+	} else {
+		_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+}
+
+func (w *compressWriter) close() {
+	// 没有达到最小长度，原样输出
+	if !w.decided {
+		w.decide(false)
+	}
+
+	if w.encoder != nil {
+		_ = w.encoder.Close()
+		w.encoder.Reset(io.Discard)
+		w.pool.Put(w.encoder)
+		w.encoder = nil
+	}
+}
+
+func (w *compressWriter) Status() int {
+	if w.decided {
+		return w.ResponseWriter.Status()
+	}
+
+	return w.status
+}
+
+func (w *compressWriter) Written() bool {
+	return w.ResponseWriter.Written() || w.buf.Len() > 0
+}
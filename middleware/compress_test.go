@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	assert.Equal(t, "gzip", negotiateEncoding("gzip, deflate, br", false))
+	assert.Equal(t, "zstd", negotiateEncoding("gzip, deflate, zstd", true))
+	assert.Equal(t, "gzip", negotiateEncoding("gzip, zstd", false))
+	assert.Equal(t, "deflate", negotiateEncoding("gzip;q=0.5, deflate", false))
+	assert.Equal(t, "deflate", negotiateEncoding("gzip;q=0, *", false))
+	assert.Equal(t, "", negotiateEncoding("br, identity", false))
+	assert.Equal(t, "", negotiateEncoding("", false))
+}
+
+func TestCompress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	large := strings.Repeat(`{"name":"hello"}`, 200)
+
+	var logged string
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		blw := newBodyLogWriter(c.Writer, 1<<20)
+		c.Writer = blw
+		c.Next()
+		logged = blw.body.String()
+	})
+	r.Use(Compress(CompressZstd(true)))
+	r.GET("/large", func(c *gin.Context) { c.Data(http.StatusOK, "application/json", []byte(large)) })
+	r.GET("/small", func(c *gin.Context) { c.Data(http.StatusOK, "application/json", []byte(`{}`)) })
+	r.GET("/png", func(c *gin.Context) { c.Data(http.StatusOK, "image/png", []byte(large)) })
+	r.GET("/encoded", func(c *gin.Context) {
+		c.Header("Content-Encoding", "br")
+		c.Data(http.StatusOK, "application/json", []byte(large))
+	})
+	r.GET("/stream", func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain")
+		_, _ = c.Writer.WriteString("chunk")
+		c.Writer.Flush()
+		_, _ = c.Writer.WriteString(large)
+	})
+
+	do := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", accept)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("/large", "gzip")
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	zr, err := gzip.NewReader(w.Body)
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(zr)
+	assert.Equal(t, large, string(body))
+	// 外层的 bodyLogWriter 记录的是压缩前的内容
+	assert.Equal(t, large, logged)
+
+	// 复用池中的 writer
+	w = do("/large", "gzip")
+	zr, err = gzip.NewReader(w.Body)
+	assert.NoError(t, err)
+	body, _ = io.ReadAll(zr)
+	assert.Equal(t, large, string(body))
+
+	// deflate 需要是 zlib 格式，复用后仍然正确
+	for i := 0; i < 2; i++ {
+		w = do("/large", "deflate")
+		assert.Equal(t, "deflate", w.Header().Get("Content-Encoding"))
+		fr, err := zlib.NewReader(w.Body)
+		if assert.NoError(t, err) {
+			body, _ = io.ReadAll(fr)
+			assert.Equal(t, large, string(body))
+		}
+	}
+
+	w = do("/large", "zstd, gzip")
+	assert.Equal(t, "zstd", w.Header().Get("Content-Encoding"))
+	dec, err := zstd.NewReader(w.Body)
+	assert.NoError(t, err)
+	body, _ = io.ReadAll(dec)
+	dec.Close()
+	assert.Equal(t, large, string(body))
+
+	w = do("/large", "")
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, large, w.Body.String())
+
+	for _, path := range []string{"/small", "/png", "/stream"} {
+		w = do(path, "gzip")
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.Empty(t, w.Header().Get("Content-Encoding"), path)
+	}
+	assert.Equal(t, "chunk"+large, w.Body.String())
+
+	w = do("/encoded", "gzip")
+	assert.Equal(t, "br", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, large, w.Body.String())
+}
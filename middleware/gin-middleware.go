@@ -1,10 +1,8 @@
 package middleware
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"time"
 
@@ -25,37 +23,24 @@ type httpReqResLog struct {
 	Response   string `json:"response"`
 }
 
-type bodyLogWriter struct {
-	gin.ResponseWriter
-	body *bytes.Buffer
-}
-
-func (b bodyLogWriter) Write(bs []byte) (int, error) {
-	b.body.Write(bs)
-	return b.ResponseWriter.Write(bs)
-}
-
 const (
 	TheAction = `Action`
 )
 
-func GinInterceptorWithTrace(tra opentracing.Tracer, isResponse bool, ignoreActions ...string) gin.HandlerFunc { //nolint:funlen
+// GinInterceptorWithTrace 拦截请求和响应写入日志，同时记录到 opentracing span
+func GinInterceptorWithTrace(tra opentracing.Tracer, isResponse bool, ignoreActions ...string) gin.HandlerFunc {
+	return NewGinInterceptorWithTrace(tra, InterceptResponse(isResponse), InterceptIgnoreActions(ignoreActions...))
+}
+
+// NewGinInterceptorWithTrace 同 GinInterceptorWithTrace，可通过 InterceptorOption 定制采集、脱敏和采样
+func NewGinInterceptorWithTrace(tra opentracing.Tracer, opts ...InterceptorOption) gin.HandlerFunc { //nolint:funlen
+	o := newInterceptorOptions(opts)
+
 	return func(c *gin.Context) {
-		params := make(map[string]interface{})
-		_ = c.Request.ParseForm()
-		var action string
-
-		for k, v := range c.Request.Form {
-			params[k] = v
-			// 忽略不需要的路由trace
-			if k == TheAction {
-				for _, u := range ignoreActions {
-					if v[0] == u {
-						return
-					}
-				}
-				action = v[0]
-			}
+		action := requestAction(c)
+		// 忽略不需要的路由trace
+		if action != "" && o.isIgnored(action) {
+			return
 		}
 
 		var span opentracing.Span
@@ -66,42 +51,43 @@ func GinInterceptorWithTrace(tra opentracing.Tracer, isResponse bool, ignoreActi
 			} else {
 				span = tra.StartSpan(fmt.Sprintf("%s_%s_%s", c.Request.Method, c.Request.URL.Path, action), opentracing.ChildOf(spanCtx))
 			}
-			defer span.Finish()
+			defer finishSpan(c, span)
 
-			newCtx := opentracing.ContextWithSpan(c, span)
+			// 基于 c.Request.Context() 派生，保留前置中间件设置的截止时间
+			newCtx := opentracing.ContextWithSpan(c.Request.Context(), span)
 
 			c.Set(gadget.SpanCtxKey, newCtx)
 		}
 
-		for k, v := range c.Request.PostForm {
-			params[k] = v
+		lg := &httpReqResLog{
+			Operator: getRequestUser(c.Request.Header),
+			URI:      c.Request.URL.Path, Method: c.Request.Method,
+			Client: c.ClientIP(),
 		}
 
-		par, _ := json.Marshal(params)
-
-		var bodyBytes []byte
-		if c.Request.Body != nil {
-			bodyBytes, _ = ioutil.ReadAll(c.Request.Body)
-		}
-		c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
+		// 未被采样的请求只记录 span 的基础信息
+		if !o.sampled(c.FullPath()) {
+			c.Next()
 
-		if len(bodyBytes) > 0 {
-			par = bodyBytes
+			if span != nil {
+				span.LogFields(
+					log.String("uri", lg.URI), log.String("method", lg.Method),
+					log.String("client", lg.Client), log.Int("code", c.Writer.Status()),
+				)
+			}
+			return
 		}
 
-		lg := &httpReqResLog{
-			Operator: getRequestUser(c.Request.Header),
-			URI:      c.Request.URL.Path, Method: c.Request.Method,
-			Params: string(par), Client: c.ClientIP(),
-		}
+		lg.Params = o.captureParams(c)
 
-		blw := &bodyLogWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer}
+		blw := newBodyLogWriter(c.Writer, o.maxBodySize)
 		c.Writer = blw
 		c.Next()
 
 		lg.StatusCode = c.Writer.Status()
-		if isResponse {
-			lg.Response = blw.body.String()
+		response := o.responseBody(blw)
+		if o.isResponse {
+			lg.Response = response
 		}
 
 		logBytes, _ := json.Marshal(&lg)
@@ -110,8 +96,8 @@ func GinInterceptorWithTrace(tra opentracing.Tracer, isResponse bool, ignoreActi
 		if span != nil {
 			span.LogFields(
 				log.String("uri", lg.URI), log.String("method", lg.Method),
-				log.String("client", c.ClientIP()), log.String("params", lg.Params),
-				log.Int("code", lg.StatusCode), log.String("response", blw.body.String()),
+				log.String("client", lg.Client), log.String("params", lg.Params),
+				log.Int("code", lg.StatusCode), log.String("response", response),
 			)
 		}
 	}
@@ -134,6 +120,9 @@ func Cors() gin.HandlerFunc {
 	}
 }
 
+// GinFormatterLog 输出到 gin 默认的 writer，不经过 logger。
+//
+// Deprecated: 使用 AccessLog 输出结构化的访问日志
 func GinFormatterLog() gin.HandlerFunc {
 	return gin.LoggerWithFormatter(func(params gin.LogFormatterParams) string {
 		return fmt.Sprintf("%s - [%s] \"%s %s %s %d %s %d \"%s\" \"%s\" \"\n",
@@ -151,6 +140,28 @@ func GinFormatterLog() gin.HandlerFunc {
 	})
 }
 
+// requestAction 返回请求参数中的 Action
+func requestAction(c *gin.Context) string {
+	_ = c.Request.ParseForm()
+	if v := c.Request.Form[TheAction]; len(v) > 0 {
+		return v[0]
+	}
+
+	return ""
+}
+
+// requestTraceID 返回当前请求 span 的 trace id，未开启 trace 时为空
+func requestTraceID(c *gin.Context) string {
+	spanData := logger.SpanFields(c)
+	for i := 0; i+1 < len(spanData); i += 2 {
+		if spanData[i] == "trace_id" {
+			return fmt.Sprint(spanData[i+1])
+		}
+	}
+
+	return ""
+}
+
 func getRequestUser(header http.Header) string {
 	if re, ok := header["X-Forwarded-User"]; ok {
 		return re[0]
@@ -161,56 +172,39 @@ func getRequestUser(header http.Header) string {
 
 // GinInterceptor 用于拦截请求和响应并也写入日志
 func GinInterceptor(isResponse bool, ignoreAction ...string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		params := make(map[string]interface{})
-		ignore := false
-
-		_ = c.Request.ParseForm()
-		for k, v := range c.Request.Form {
-			params[k] = v
-			if k == TheAction {
-				for _, u := range ignoreAction {
-					if v[0] == u {
-						ignore = true
-					}
-				}
-			}
-		}
-
-		for k, v := range c.Request.PostForm {
-			params[k] = v
-		}
+	return NewGinInterceptor(InterceptResponse(isResponse), InterceptIgnoreActions(ignoreAction...))
+}
 
-		var par []byte
+// NewGinInterceptor 同 GinInterceptor，可通过 InterceptorOption 定制采集、脱敏和采样
+func NewGinInterceptor(opts ...InterceptorOption) gin.HandlerFunc {
+	o := newInterceptorOptions(opts)
 
-		if !ignore {
-			par, _ = json.Marshal(params)
-			var bodyBytes []byte
-			if c.Request.Body != nil {
-				bodyBytes, _ = ioutil.ReadAll(c.Request.Body)
-			}
-			c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
+	return func(c *gin.Context) {
+		if !o.sampled(c.FullPath()) {
+			c.Next()
+			return
+		}
 
-			if len(bodyBytes) > 0 {
-				par = bodyBytes
-			}
+		var par string
+		if action := requestAction(c); action == "" || !o.isIgnored(action) {
+			par = o.captureParams(c)
 		}
 
 		lg := &httpReqResLog{
 			Operator: getRequestUser(c.Request.Header),
 			URI:      c.Request.RequestURI,
 			Method:   c.Request.Method,
-			Params:   string(par),
+			Params:   par,
 			Client:   c.ClientIP(),
 		}
 
-		blw := &bodyLogWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer}
+		blw := newBodyLogWriter(c.Writer, o.maxBodySize)
 		c.Writer = blw
 		c.Next()
 
 		lg.StatusCode = c.Writer.Status()
-		if isResponse {
-			lg.Response = blw.body.String()
+		if o.isResponse {
+			lg.Response = o.responseBody(blw)
 		}
 
 		logBytes, _ := json.Marshal(&lg)
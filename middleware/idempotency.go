@@ -0,0 +1,261 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/maxliu9403/common/gadget"
+	"github.com/maxliu9403/common/logger"
+	"github.com/maxliu9403/common/rediscache"
+	"github.com/opentracing/opentracing-go"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotencyReplayedHeader = "Idempotent-Replayed"
+)
+
+type idempotencyOptions struct {
+	cli            *redis.Client
+	prefix         string
+	ttl            time.Duration
+	lockExpiration int
+	maxBodySize    int
+	methods        map[string]bool
+	newCRUD        func(ctx context.Context, cli *redis.Client) rediscache.BasicCrud
+}
+
+// IdempotencyOption 用于定制 Idempotency 中间件
+type IdempotencyOption func(*idempotencyOptions)
+
+// IdempotencyRedis 指定使用的 redis 客户端，默认使用 rediscache.GetCli()
+func IdempotencyRedis(cli *redis.Client) IdempotencyOption {
+	return func(o *idempotencyOptions) { o.cli = cli }
+}
+
+// IdempotencyPrefix 指定 redis key 的前缀
+func IdempotencyPrefix(prefix string) IdempotencyOption {
+	return func(o *idempotencyOptions) { o.prefix = prefix }
+}
+
+// IdempotencyTTL 首次响应的保存时间，默认 24 小时
+func IdempotencyTTL(ttl time.Duration) IdempotencyOption {
+	return func(o *idempotencyOptions) { o.ttl = ttl }
+}
+
+// IdempotencyLockExpiration 处理中的锁过期时间，单位秒，锁会自动续约，默认 10 秒
+func IdempotencyLockExpiration(expiration int) IdempotencyOption {
+	return func(o *idempotencyOptions) { o.lockExpiration = expiration }
+}
+
+// IdempotencyMaxBodySize 请求体和可保存的响应体的最大字节数，默认 1MB；
+// 请求体超出时返回 413，响应体超出时不保存响应
+func IdempotencyMaxBodySize(size int) IdempotencyOption {
+	return func(o *idempotencyOptions) { o.maxBodySize = size }
+}
+
+// IdempotencyMethods 需要处理 Idempotency-Key 的请求方法，默认仅 POST
+func IdempotencyMethods(methods ...string) IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		o.methods = make(map[string]bool)
+		for _, m := range methods {
+			o.methods[strings.ToUpper(m)] = true
+		}
+	}
+}
+
+type idempotencyRecord struct {
+	Fingerprint string      `json:"fingerprint"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+}
+
+// Idempotency 根据请求头 Idempotency-Key 保证请求只被处理一次：
+// 首次请求处理完成后保存响应，相同 key 的重试直接返回保存的响应；
+// 首次请求仍在处理时返回 409；相同 key 但请求内容不同时返回 422。
+// 5xx 响应不会被保存，客户端可以使用相同的 key 重试。redis 不可用时直接放行。
+func Idempotency(opts ...IdempotencyOption) gin.HandlerFunc { //nolint:funlen
+	o := &idempotencyOptions{
+		prefix:         "idempotency",
+		ttl:            24 * time.Hour,
+		lockExpiration: 10,
+		maxBodySize:    1 << 20,
+		methods:        map[string]bool{http.MethodPost: true},
+		newCRUD:        rediscache.NewCRUD,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || !o.methods[c.Request.Method] {
+			c.Next()
+			return
+		}
+
+		cli := o.cli
+		if cli == nil {
+			cli = rediscache.GetCli()
+		}
+		if cli == nil {
+			logger.WarnfWithTrace(c, "idempotency: redis client is not initialized yet, skip key %s", key)
+			c.Next()
+			return
+		}
+
+		fingerprint, err := requestFingerprint(c, o.maxBodySize)
+		if err == errBodyTooLarge {
+			abortWithResponse(c, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		if err != nil {
+			abortWithResponse(c, http.StatusBadRequest, fmt.Sprintf("read request body failed: %s", err.Error()))
+			return
+		}
+
+		// 不同用户之间的 key 互不影响
+		recordKey := fmt.Sprintf("%s:%s:%s:%s", o.prefix, getRequestUser(c.Request.Header), c.Request.URL.Path, key)
+		lockKey := recordKey + ":lock"
+		crud := o.newCRUD(c, cli)
+		// 加锁、保存响应和释放锁不受请求截止时间的影响，否则超时后锁只能等待过期；
+		// 续约由加锁的实例管理，加锁和释放锁需要使用同一个实例
+		detached := o.newCRUD(detachedContext(c), cli)
+
+		if replayIdempotentResponse(c, crud, recordKey, fingerprint) {
+			return
+		}
+
+		lockValue := fingerprint + ":" + gadget.UUID()
+		ok, err := detached.TryLock(lockKey, lockValue, o.lockExpiration)
+		if err != nil {
+			logger.WarnfWithTrace(c, "idempotency: lock key %s failed: %s", key, err.Error())
+			c.Next()
+			return
+		}
+
+		if !ok {
+			// 拿锁失败时，首次请求可能刚好处理完成
+			if replayIdempotentResponse(c, crud, recordKey, fingerprint) {
+				return
+			}
+
+			holder, _ := crud.Get(lockKey)
+			if holder != "" && !strings.HasPrefix(holder, fingerprint+":") {
+				abortWithResponse(c, http.StatusUnprocessableEntity, "Idempotency-Key is already used by another request")
+				return
+			}
+
+			abortWithResponse(c, http.StatusConflict, "a request with the same Idempotency-Key is in progress")
+			return
+		}
+
+		defer func() {
+			if e := detached.UnLock(lockKey, lockValue); e != nil {
+				logger.WarnfWithTrace(c, "idempotency: unlock key %s failed: %s", key, e.Error())
+			}
+		}()
+
+		// 首次请求可能在两次检查之间保存响应并释放锁，持有锁后需要再检查一次
+		if replayIdempotentResponse(c, crud, recordKey, fingerprint) {
+			return
+		}
+
+		blw := newBodyLogWriter(c.Writer, o.maxBodySize)
+		c.Writer = blw
+		c.Next()
+
+		status := c.Writer.Status()
+		if status >= http.StatusInternalServerError || blw.truncated {
+			return
+		}
+
+		data, _ := json.Marshal(idempotencyRecord{
+			Fingerprint: fingerprint,
+			Status:      status,
+			Header:      blw.Header().Clone(),
+			Body:        blw.body.Bytes(),
+		})
+		if e := detached.Set(recordKey, data, o.ttl); e != nil {
+			logger.WarnfWithTrace(c, "idempotency: save response of key %s failed: %s", key, e.Error())
+		}
+	}
+}
+
+// replayIdempotentResponse 若已有保存的响应，则回放响应或在请求内容不一致时返回 422
+func replayIdempotentResponse(c *gin.Context, crud rediscache.BasicCrud, recordKey, fingerprint string) bool {
+	val, err := crud.Get(recordKey)
+	if err != nil {
+		if err != redis.Nil {
+			logger.WarnfWithTrace(c, "idempotency: get record %s failed: %s", recordKey, err.Error())
+		}
+		return false
+	}
+
+	var record idempotencyRecord
+	if err = json.Unmarshal([]byte(val), &record); err != nil {
+		return false
+	}
+
+	if record.Fingerprint != fingerprint {
+		abortWithResponse(c, http.StatusUnprocessableEntity, "Idempotency-Key is already used by another request")
+		return true
+	}
+
+	for k, v := range record.Header {
+		c.Writer.Header()[k] = v
+	}
+	c.Header(IdempotencyReplayedHeader, "true")
+	c.Status(record.Status)
+	_, _ = c.Writer.Write(record.Body)
+	c.Abort()
+
+	return true
+}
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// detachedContext 保留请求的链路信息，但不继承请求的截止时间和取消
+func detachedContext(c *gin.Context) context.Context {
+	ctx := context.Background()
+	if spanCtx, err := gadget.ExtractTraceSpan(c); err == nil {
+		if span := opentracing.SpanFromContext(spanCtx); span != nil {
+			ctx = opentracing.ContextWithSpan(ctx, span)
+		}
+	}
+
+	return ctx
+}
+
+// requestFingerprint 计算请求方法、路径、查询参数和请求体的摘要，请求体最多读取 limit 字节
+func requestFingerprint(c *gin.Context, limit int) (string, error) {
+	h := sha256.New()
+	_, _ = io.WriteString(h, c.Request.Method+"\n"+c.Request.URL.Path+"\n"+c.Request.URL.Query().Encode()+"\n")
+
+	if c.Request.Body != nil {
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, int64(limit)+1))
+		if err != nil {
+			return "", err
+		}
+		if len(body) > limit {
+			return "", errBodyTooLarge
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
+		h.Write(body)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
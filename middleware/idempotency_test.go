@@ -0,0 +1,289 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/maxliu9403/common/rediscache"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryCRUD 内存实现的 rediscache.BasicCrud，各个请求共享同一份数据
+type memoryCRUD struct {
+	lock       sync.Mutex
+	data       map[string]string
+	beforeLock func()  // TryLock 之前调用，用于模拟并发的请求
+	ctxErrs    []error // Set 和 UnLock 时 ctx 的状态
+	renewing   int32   // 正在续约的锁的数量
+}
+
+// memoryCRUDSession 与 rediscache.RedisCrud 一样，续约只能由加锁的实例取消
+type memoryCRUDSession struct {
+	*memoryCRUD
+	ctx      context.Context
+	renewals map[string]context.CancelFunc
+}
+
+func (m *memoryCRUD) session(ctx context.Context, _ *redis.Client) rediscache.BasicCrud {
+	return &memoryCRUDSession{memoryCRUD: m, ctx: ctx, renewals: map[string]context.CancelFunc{}}
+}
+
+func (m *memoryCRUD) get(key string) string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.data[key]
+}
+
+func (s *memoryCRUDSession) Set(key string, value interface{}, _ time.Duration) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.ctxErrs = append(s.ctxErrs, s.ctx.Err())
+	switch v := value.(type) {
+	case []byte:
+		s.data[key] = string(v)
+	default:
+		s.data[key] = v.(string)
+	}
+	return nil
+}
+
+func (s *memoryCRUDSession) Get(key string) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	v, ok := s.data[key]
+	if !ok {
+		return "", redis.Nil
+	}
+	return v, nil
+}
+
+func (s *memoryCRUDSession) UnLock(key, uuid string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.ctxErrs = append(s.ctxErrs, s.ctx.Err())
+	if s.data[key] == uuid {
+		delete(s.data, key)
+	}
+	if cancel, ok := s.renewals[key+uuid]; ok {
+		cancel()
+		delete(s.renewals, key+uuid)
+	}
+	return nil
+}
+
+func (s *memoryCRUDSession) TryLock(key, uuid string, _ int) (bool, error) {
+	if s.beforeLock != nil {
+		s.beforeLock()
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.data[key]; ok {
+		return false, nil
+	}
+	s.data[key] = uuid
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.renewals[key+uuid] = cancel
+	atomic.AddInt32(&s.renewing, 1)
+	go func() {
+		<-ctx.Done()
+		atomic.AddInt32(&s.renewing, -1)
+	}()
+	return true, nil
+}
+
+func (s *memoryCRUDSession) TryLockBlocking(key, uuid string, expiration, _ int, _ time.Duration) (bool, error) {
+	return s.TryLock(key, uuid, expiration)
+}
+
+func newIdempotencyRouter(store *memoryCRUD, handler gin.HandlerFunc, opts ...IdempotencyOption) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	opts = append(opts,
+		IdempotencyRedis(redis.NewClient(&redis.Options{})),
+		func(o *idempotencyOptions) { o.newCRUD = store.session },
+	)
+
+	r := gin.New()
+	r.Use(Idempotency(opts...))
+	r.POST("/orders", handler)
+	return r
+}
+
+func idempotentRequest(key, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	req.Header.Set(IdempotencyKeyHeader, key)
+	return req
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	store := &memoryCRUD{data: map[string]string{}}
+	var calls int
+	r := newIdempotencyRouter(store, func(c *gin.Context) {
+		calls++
+		c.Header("X-Order", "1")
+		c.String(http.StatusCreated, "created")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, idempotentRequest("k1", `{"n":1}`))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Header().Get(IdempotencyReplayedHeader))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, idempotentRequest("k1", `{"n":1}`))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "created", w.Body.String())
+	assert.Equal(t, "1", w.Header().Get("X-Order"))
+	assert.Equal(t, "true", w.Header().Get(IdempotencyReplayedHeader))
+	assert.Equal(t, 1, calls)
+
+	// 相同 key 不同请求体
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, idempotentRequest("k1", `{"n":2}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, 1, calls)
+
+	// 锁已释放
+	for k := range store.data {
+		assert.False(t, strings.HasSuffix(k, ":lock"), k)
+	}
+}
+
+func TestIdempotencyStopRenew(t *testing.T) {
+	store := &memoryCRUD{data: map[string]string{}}
+	r := newIdempotencyRouter(store, func(c *gin.Context) { c.String(http.StatusCreated, "created") })
+
+	// 请求的 ctx 没有结束，释放锁后续约也要停止
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, idempotentRequest("k1", `{"n":1}`).WithContext(ctx))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&store.renewing) == 0 }, time.Second, time.Millisecond)
+}
+
+func TestIdempotencyInProgress(t *testing.T) {
+	store := &memoryCRUD{data: map[string]string{}}
+	inHandler := make(chan struct{})
+	release := make(chan struct{})
+	r := newIdempotencyRouter(store, func(c *gin.Context) {
+		close(inHandler)
+		<-release
+		c.String(http.StatusOK, "ok")
+	})
+
+	done := make(chan struct{})
+	go func() {
+		r.ServeHTTP(httptest.NewRecorder(), idempotentRequest("k1", `{"n":1}`))
+		close(done)
+	}()
+	<-inHandler
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, idempotentRequest("k1", `{"n":1}`))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, idempotentRequest("k1", `{"n":2}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	close(release)
+	<-done
+}
+
+func TestIdempotencySkipServerError(t *testing.T) {
+	store := &memoryCRUD{data: map[string]string{}}
+	var calls int
+	r := newIdempotencyRouter(store, func(c *gin.Context) {
+		calls++
+		if calls == 1 {
+			c.String(http.StatusInternalServerError, "boom")
+			return
+		}
+		c.String(http.StatusOK, "ok")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, idempotentRequest("k1", `{}`))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, idempotentRequest("k1", `{}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 2, calls)
+}
+
+func TestIdempotencyConcurrentDuplicate(t *testing.T) {
+	store := &memoryCRUD{data: map[string]string{}}
+	var calls int
+	r := newIdempotencyRouter(store, func(c *gin.Context) {
+		calls++
+		c.String(http.StatusCreated, "created")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, idempotentRequest("k1", `{}`))
+	assert.Equal(t, 1, calls)
+
+	// 第二个请求首次检查时还没有记录，拿锁前首次请求刚好保存了响应并释放锁
+	var record, recordKey string
+	for k, v := range store.data {
+		record, recordKey = v, k
+	}
+	delete(store.data, recordKey)
+	store.beforeLock = func() {
+		store.lock.Lock()
+		store.data[recordKey] = record
+		store.lock.Unlock()
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, idempotentRequest("k1", `{}`))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "true", w.Header().Get(IdempotencyReplayedHeader))
+	assert.Equal(t, 1, calls)
+}
+
+func TestIdempotencyDetachedContext(t *testing.T) {
+	store := &memoryCRUD{data: map[string]string{}}
+	r := newIdempotencyRouter(store, func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	// 请求的 ctx 已取消时仍然保存响应并释放锁
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := idempotentRequest("k1", `{}`).WithContext(ctx)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, []error{nil, nil}, store.ctxErrs)
+	assert.Len(t, store.data, 1)
+}
+
+func TestIdempotencyBodyLimit(t *testing.T) {
+	store := &memoryCRUD{data: map[string]string{}}
+	var calls int
+	r := newIdempotencyRouter(store, func(c *gin.Context) {
+		calls++
+		c.String(http.StatusOK, "ok")
+	}, IdempotencyMaxBodySize(8))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, idempotentRequest("k1", strings.Repeat("a", 9)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, 0, calls)
+	assert.Empty(t, store.get("k1"))
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	requestTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_server_request_timeouts_total",
+		Help: "Total number of requests aborted by the timeout middleware.",
+	}, []string{"method", "route"})
+	requestPanics = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_server_panics_total",
+		Help: "Total number of panics recovered by the recovery middleware.",
+	}, []string{"method", "route"})
+)
+
+func init() {
+	prometheus.MustRegister(requestTimeouts, requestPanics)
+}
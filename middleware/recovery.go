@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maxliu9403/common/gadget"
+	"github.com/maxliu9403/common/httputil"
+	"github.com/maxliu9403/common/logger"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+// PanicInfo handler panic 时的现场信息
+type PanicInfo struct {
+	Error     string    `json:"error"`
+	Stack     string    `json:"stack"`
+	Method    string    `json:"method"`
+	Route     string    `json:"route"`
+	URI       string    `json:"uri"`
+	Client    string    `json:"client"`
+	Host      string    `json:"host"`
+	RequestID string    `json:"request_id,omitempty"`
+	TraceID   string    `json:"trace_id,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// PanicHook 在 panic 被恢复后异步调用，用于告警等，hook 自身的 panic 会被忽略
+type PanicHook func(info *PanicInfo)
+
+// WebhookPanicHook 把 PanicInfo 以 JSON 格式 POST 到 url
+func WebhookPanicHook(url string, opts ...httputil.SendOption) PanicHook {
+	return func(info *PanicInfo) {
+		data, err := json.Marshal(info)
+		if err != nil {
+			return
+		}
+
+		sendOpts := append([]httputil.SendOption{
+			httputil.SendTimeout(3 * time.Second),
+			httputil.SendHeaders(map[string]string{"Content-Type": "application/json"}),
+		}, opts...)
+		sendOpts = append(sendOpts, httputil.SendBody(bytes.NewReader(data)))
+
+		resp, err := httputil.Post(url, sendOpts...)
+		if err != nil {
+			logger.Errorf("send panic webhook failed: %s", err.Error())
+			return
+		}
+		_ = resp.Body.Close()
+	}
+}
+
+type recoveryOptions struct {
+	hooks []PanicHook
+}
+
+// RecoveryOption 用于定制 Recovery 中间件
+type RecoveryOption func(*recoveryOptions)
+
+// RecoveryHook 追加 panic 的回调
+func RecoveryHook(hooks ...PanicHook) RecoveryOption {
+	return func(o *recoveryOptions) { o.hooks = append(o.hooks, hooks...) }
+}
+
+// Recovery 恢复 handler 中的 panic，携带 trace 信息记录堆栈，把 span 标记为错误，并以标准响应结构返回 500。
+// 客户端断开连接导致的 panic 不返回响应，只记录日志。
+func Recovery(opts ...RecoveryOption) gin.HandlerFunc {
+	o := &recoveryOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	host, _ := os.Hostname()
+
+	return func(c *gin.Context) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			// 由 net/http 处理，用于主动中断响应
+			if r == http.ErrAbortHandler {
+				panic(r)
+			}
+
+			info := &PanicInfo{
+				Error:     fmt.Sprint(r),
+				Stack:     string(debug.Stack()),
+				Method:    c.Request.Method,
+				Route:     c.FullPath(),
+				URI:       c.Request.URL.RequestURI(),
+				Client:    c.ClientIP(),
+				Host:      host,
+				RequestID: c.GetString(RequestIDKey),
+				TraceID:   requestTraceID(c),
+				Time:      time.Now(),
+			}
+
+			// 拦截器在外层时 span 已由 finishSpan 标记并结束，不再重复标记
+			if !c.GetBool(spanPanicKey) {
+				if spanCtx, err := gadget.ExtractTraceSpan(c); err == nil {
+					if span := opentracing.SpanFromContext(spanCtx); span != nil {
+						markSpanPanic(span, r)
+					}
+				}
+			}
+
+			if isBrokenPipe(r) {
+				logger.WarnfWithTrace(c, "[Recovery] connection broken: %s, method: %s, uri: %s, client: %s",
+					info.Error, info.Method, info.URI, info.Client)
+				_ = c.Error(fmt.Errorf("%v", r))
+				c.Abort()
+				return
+			}
+
+			logger.ErrorfWithTrace(c, "[Recovery] panic recovered: %s, method: %s, uri: %s, route: %s, client: %s, request_id: %s\n%s",
+				info.Error, info.Method, info.URI, info.Route, info.Client, info.RequestID, info.Stack)
+			requestPanics.WithLabelValues(info.Method, info.Route).Inc()
+
+			for _, hook := range o.hooks {
+				go runPanicHook(hook, info)
+			}
+
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			abortWithResponse(c, http.StatusInternalServerError, "internal server error")
+		}()
+
+		c.Next()
+	}
+}
+
+func runPanicHook(hook PanicHook, info *PanicInfo) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("panic hook panicked: %v", r)
+		}
+	}()
+
+	hook(info)
+}
+
+func markSpanPanic(span opentracing.Span, r interface{}) {
+	ext.Error.Set(span, true)
+	span.LogFields(log.String("event", "error"), log.String("error.kind", "panic"), log.String("message", fmt.Sprint(r)))
+}
+
+// spanPanicKey finishSpan 已把 span 标记为 panic
+const spanPanicKey = "span_panic_marked"
+
+// finishSpan 结束 span，handler panic 时先把 span 标记为错误，再继续向上抛出交给 Recovery 处理；
+// Recovery 在内层时 panic 已被恢复并标记，这里只结束 span
+func finishSpan(c *gin.Context, span opentracing.Span) {
+	if r := recover(); r != nil {
+		markSpanPanic(span, r)
+		c.Set(spanPanicKey, true)
+		span.Finish()
+		panic(r)
+	}
+
+	span.Finish()
+}
+
+func isBrokenPipe(r interface{}) bool {
+	err, ok := r.(error)
+	if !ok {
+		return false
+	}
+
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		return false
+	}
+
+	msg := strings.ToLower(opErr.Error())
+	return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestRecovery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hooked := make(chan *PanicInfo, 1)
+
+	r := gin.New()
+	r.Use(Recovery(RecoveryHook(func(info *PanicInfo) { hooked <- info })))
+	r.GET("/panic/:id", func(c *gin.Context) { panic("boom") })
+	r.GET("/written", func(c *gin.Context) {
+		c.String(http.StatusAccepted, "partial")
+		panic("boom after write")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic/1?x=y", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"RetCode":500,"Message":"internal server error"}`, w.Body.String())
+
+	select {
+	case info := <-hooked:
+		assert.Equal(t, "boom", info.Error)
+		assert.Equal(t, "/panic/:id", info.Route)
+		assert.Equal(t, "/panic/1?x=y", info.URI)
+		assert.Contains(t, info.Stack, "recovery_test.go")
+	case <-time.After(time.Second):
+		t.Fatal("panic hook is not called")
+	}
+
+	// 已经写出的响应不再追加错误信息
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/written", nil))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "partial", w.Body.String())
+	<-hooked
+}
+
+func TestRecoverySpan(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// 无论 Recovery 在拦截器的内层还是外层，span 都只标记一次，且在结束前标记
+	for name, inner := range map[string]bool{"recovery inside": true, "recovery outside": false} {
+		reporter := jaeger.NewInMemoryReporter()
+		tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), reporter)
+
+		r := gin.New()
+		if inner {
+			r.Use(NewGinInterceptorWithTrace(tracer), Recovery())
+		} else {
+			r.Use(Recovery(), NewGinInterceptorWithTrace(tracer))
+		}
+		r.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+		assert.Equal(t, http.StatusInternalServerError, w.Code, name)
+
+		// Close 会清空 reporter 中的 span，需要先取出
+		spans := reporter.GetSpans()
+		_ = closer.Close()
+		if !assert.Len(t, spans, 1, name) {
+			continue
+		}
+		span := spans[0].(*jaeger.Span)
+		assert.Equal(t, true, span.Tags()["error"], name)
+
+		var marked int
+		for _, l := range span.Logs() {
+			for _, f := range l.Fields {
+				if f.Key() == "error.kind" && f.Value() == "panic" {
+					marked++
+				}
+			}
+		}
+		assert.Equal(t, 1, marked, name)
+	}
+}
@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// Response 标准响应结构，与 /ping 等接口的返回格式保持一致
+type Response struct {
+	RetCode int    `json:"RetCode"`
+	Message string `json:"Message"`
+}
+
+// abortWithResponse 中止后续 handler，并以标准响应结构返回错误，RetCode 与 HTTP 状态码一致
+func abortWithResponse(c *gin.Context, status int, message string) {
+	c.AbortWithStatusJSON(status, Response{RetCode: status, Message: message})
+}
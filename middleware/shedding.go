@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maxliu9403/common/ratelimiter"
+)
+
+type sheddingOptions struct {
+	defaultPriority ratelimiter.Priority
+	routes          map[string]ratelimiter.Priority
+	retryAfter      int
+}
+
+// SheddingOption 用于定制 LoadShedding 中间件
+type SheddingOption func(*sheddingOptions)
+
+// SheddingPriority 设置路由（gin 的 FullPath）的优先级
+func SheddingPriority(p ratelimiter.Priority, routes ...string) SheddingOption {
+	return func(o *sheddingOptions) {
+		for _, r := range routes {
+			o.routes[r] = p
+		}
+	}
+}
+
+// SheddingDefaultPriority 未单独设置的路由使用的优先级，默认 PriorityNormal
+func SheddingDefaultPriority(p ratelimiter.Priority) SheddingOption {
+	return func(o *sheddingOptions) { o.defaultPriority = p }
+}
+
+// SheddingRetryAfter 被丢弃的请求返回的 Retry-After，单位秒
+func SheddingRetryAfter(seconds int) SheddingOption {
+	return func(o *sheddingOptions) { o.retryAfter = seconds }
+}
+
+// LoadShedding 使用自适应限流器限制进行中的请求数，过载时返回 503。
+// /ping 默认为 PriorityCritical，永远不会被丢弃。
+// handler 返回 503/504 或请求超时时视为过载信号，限流器会收缩并发上限。
+func LoadShedding(limiter *ratelimiter.AdaptiveLimiter, opts ...SheddingOption) gin.HandlerFunc {
+	o := &sheddingOptions{
+		defaultPriority: ratelimiter.PriorityNormal,
+		routes:          map[string]ratelimiter.Priority{"/ping": ratelimiter.PriorityCritical},
+		retryAfter:      1,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return func(c *gin.Context) {
+		p, ok := o.routes[c.FullPath()]
+		if !ok {
+			p = o.defaultPriority
+		}
+
+		release, err := limiter.Acquire(c.Request.Context(), p)
+		if err != nil {
+			c.Header("Retry-After", strconv.Itoa(o.retryAfter))
+			abortWithResponse(c, http.StatusServiceUnavailable, "server is overloaded, please retry later")
+			return
+		}
+
+		start := time.Now()
+		// handler panic 时同样释放并发额度，并视为失败
+		dropped := true
+		defer func() { release(time.Since(start), dropped) }()
+
+		c.Next()
+
+		status := c.Writer.Status()
+		dropped = status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout ||
+			c.Request.Context().Err() != nil
+	}
+}
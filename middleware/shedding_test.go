@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maxliu9403/common/ratelimiter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadSheddingPanic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := ratelimiter.NewAdaptiveLimiter("shedding-test", ratelimiter.AdaptiveConfig{InitialLimit: 10, MinLimit: 1})
+
+	r := gin.New()
+	r.Use(Recovery(), LoadShedding(limiter))
+	r.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	// panic 后释放了并发额度，并按失败收缩上限
+	stats := limiter.Stats()
+	assert.Equal(t, 0, stats.Inflight)
+	assert.Less(t, stats.Limit, 10)
+}
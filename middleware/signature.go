@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/maxliu9403/common/httputil"
+	"github.com/maxliu9403/common/logger"
+	"github.com/maxliu9403/common/rediscache"
+)
+
+const SignatureKeyIDKey = "signature_key_id"
+
+// KeyRegistry 根据 key id 查找签名密钥
+type KeyRegistry interface {
+	Secret(keyID string) (secret []byte, ok bool)
+}
+
+// StaticKeyRegistry 使用固定的 key id 与密钥的映射
+type StaticKeyRegistry map[string]string
+
+func (r StaticKeyRegistry) Secret(keyID string) ([]byte, bool) {
+	secret, ok := r[keyID]
+	return []byte(secret), ok
+}
+
+// NonceStore 记录已使用的随机数，用于防重放
+type NonceStore interface {
+	// Remember 记录 nonce，nonce 在 ttl 内已被使用过时返回 false
+	Remember(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
+
+// RedisNonceStore 基于 redis SETNX 的 NonceStore，cli 为空时使用 rediscache.GetCli()
+type RedisNonceStore struct {
+	cli    *redis.Client
+	prefix string
+}
+
+func NewRedisNonceStore(cli *redis.Client, prefix string) *RedisNonceStore {
+	if prefix == "" {
+		prefix = "signature:nonce"
+	}
+
+	return &RedisNonceStore{cli: cli, prefix: prefix}
+}
+
+func (s *RedisNonceStore) Remember(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	cli := s.cli
+	if cli == nil {
+		cli = rediscache.GetCli()
+	}
+	if cli == nil {
+		return false, fmt.Errorf("redis client is not initialized yet")
+	}
+
+	return cli.SetNX(ctx, s.prefix+":"+nonce, 1, ttl).Result()
+}
+
+type signatureOptions struct {
+	skew        time.Duration
+	nonceStore  NonceStore
+	maxBodySize int64
+}
+
+// SignatureOption 用于定制 VerifySignature 中间件
+type SignatureOption func(*signatureOptions)
+
+// SignatureClockSkew 允许的时间偏差，默认 5 分钟
+func SignatureClockSkew(skew time.Duration) SignatureOption {
+	return func(o *signatureOptions) { o.skew = skew }
+}
+
+// SignatureNonceStore 指定防重放使用的存储，默认使用 redis
+func SignatureNonceStore(store NonceStore) SignatureOption {
+	return func(o *signatureOptions) { o.nonceStore = store }
+}
+
+// SignatureMaxBodySize 请求体的最大字节数，签名校验前需要读取整个请求体，超出时返回 413，默认 1MB
+func SignatureMaxBodySize(size int64) SignatureOption {
+	return func(o *signatureOptions) { o.maxBodySize = size }
+}
+
+// VerifySignature 校验 httputil.SendSign 生成的签名，通过后 key id 保存在 c.Keys 的 signature_key_id 中。
+// 时间戳超出允许偏差或随机数被重复使用的请求会被拒绝，防重放存储不可用时同样拒绝请求。
+func VerifySignature(registry KeyRegistry, opts ...SignatureOption) gin.HandlerFunc {
+	o := &signatureOptions{skew: 5 * time.Minute, maxBodySize: 1 << 20}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.nonceStore == nil {
+		o.nonceStore = NewRedisNonceStore(nil, "")
+	}
+
+	return func(c *gin.Context) {
+		keyID := c.GetHeader(httputil.SignKeyIDHeader)
+		timestamp := c.GetHeader(httputil.SignTimestampHeader)
+		nonce := c.GetHeader(httputil.SignNonceHeader)
+		signature := c.GetHeader(httputil.SignatureHeader)
+		if keyID == "" || timestamp == "" || nonce == "" || signature == "" {
+			abortWithResponse(c, http.StatusUnauthorized, "missing signature")
+			return
+		}
+
+		secret, ok := registry.Secret(keyID)
+		if !ok {
+			abortWithResponse(c, http.StatusUnauthorized, "unknown signature key id")
+			return
+		}
+
+		ts, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			abortWithResponse(c, http.StatusUnauthorized, "invalid signature timestamp")
+			return
+		}
+		if diff := time.Since(time.Unix(ts, 0)); diff > o.skew || diff < -o.skew {
+			abortWithResponse(c, http.StatusUnauthorized, "signature expired")
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			body, err = io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, o.maxBodySize))
+			if err != nil && int64(len(body)) >= o.maxBodySize {
+				abortWithResponse(c, http.StatusRequestEntityTooLarge, errBodyTooLarge.Error())
+				return
+			}
+			if err != nil {
+				abortWithResponse(c, http.StatusBadRequest, fmt.Sprintf("read request body failed: %s", err.Error()))
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
+		}
+
+		stringToSign := httputil.StringToSign(c.Request.Method, c.Request.URL.EscapedPath(), c.Request.URL.RawQuery, body, timestamp, nonce)
+		if !hmac.Equal([]byte(httputil.Sign(secret, stringToSign)), []byte(signature)) {
+			abortWithResponse(c, http.StatusUnauthorized, "invalid signature")
+			return
+		}
+
+		// 签名校验通过后再记录 nonce，避免伪造的请求占用 nonce
+		fresh, err := o.nonceStore.Remember(c, keyID+":"+nonce, 2*o.skew)
+		if err != nil {
+			logger.ErrorfWithTrace(c, "verify signature: remember nonce failed: %s", err.Error())
+			abortWithResponse(c, http.StatusServiceUnavailable, "signature nonce store unavailable")
+			return
+		}
+		if !fresh {
+			abortWithResponse(c, http.StatusUnauthorized, "signature nonce has been used")
+			return
+		}
+
+		c.Set(SignatureKeyIDKey, keyID)
+		c.Next()
+	}
+}
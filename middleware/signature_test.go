@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/gin-gonic/gin"
+	"github.com/maxliu9403/common/httputil"
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryNonceStore struct {
+	lock sync.Mutex
+	seen map[string]bool
+}
+
+func (s *memoryNonceStore) Remember(_ context.Context, nonce string, _ time.Duration) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.seen[nonce] {
+		return false, nil
+	}
+	s.seen[nonce] = true
+
+	return true, nil
+}
+
+func signedRequest(body string, ts time.Time, nonce, secret string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/orders?b=2&a=1", strings.NewReader(body))
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+	stringToSign := httputil.StringToSign(req.Method, req.URL.EscapedPath(), req.URL.RawQuery, []byte(body), timestamp, nonce)
+
+	req.Header.Set(httputil.SignKeyIDHeader, "svc")
+	req.Header.Set(httputil.SignTimestampHeader, timestamp)
+	req.Header.Set(httputil.SignNonceHeader, nonce)
+	req.Header.Set(httputil.SignatureHeader, httputil.Sign([]byte(secret), stringToSign))
+
+	return req
+}
+
+func TestVerifySignature(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(VerifySignature(StaticKeyRegistry{"svc": "s3cret"}, SignatureNonceStore(&memoryNonceStore{seen: map[string]bool{}})))
+	r.POST("/orders", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, c.GetString(SignatureKeyIDKey)+":"+string(body))
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, signedRequest(`{"id":1}`, time.Now(), "n1", "s3cret"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `svc:{"id":1}`, w.Body.String())
+
+	// 重放
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, signedRequest(`{"id":1}`, time.Now(), "n1", "s3cret"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, signedRequest(`{"id":1}`, time.Now(), "n2", "wrong"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, signedRequest(`{"id":1}`, time.Now().Add(-10*time.Minute), "n3", "s3cret"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// 篡改请求体
+	req := signedRequest(`{"id":1}`, time.Now(), "n4", "s3cret")
+	req.Body = io.NopCloser(strings.NewReader(`{"id":2}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestVerifySignatureBodyLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(VerifySignature(StaticKeyRegistry{"svc": "s3cret"}, SignatureMaxBodySize(8),
+		SignatureNonceStore(&memoryNonceStore{seen: map[string]bool{}})))
+	r.POST("/orders", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// 超出限制时不读取剩余的请求体，直接拒绝
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, signedRequest(strings.Repeat("x", 9), time.Now(), "n1", "s3cret"))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, signedRequest(strings.Repeat("x", 8), time.Now(), "n2", "s3cret"))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestSendSignVerified(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var lock sync.Mutex
+	var nonces, timestamps []string
+
+	r := gin.New()
+	r.Use(VerifySignature(StaticKeyRegistry{"svc": "s3cret"}, SignatureNonceStore(&memoryNonceStore{seen: map[string]bool{}})))
+	r.POST("/orders", func(c *gin.Context) {
+		lock.Lock()
+		nonces = append(nonces, c.GetHeader(httputil.SignNonceHeader))
+		timestamps = append(timestamps, c.GetHeader(httputil.SignTimestampHeader))
+		attempt := len(nonces)
+		lock.Unlock()
+
+		body, _ := io.ReadAll(c.Request.Body)
+		if c.Query("fail") != "" && attempt == 1 {
+			c.Status(http.StatusServiceUnavailable)
+			return
+		}
+		c.String(http.StatusOK, string(body))
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	resp, err := httputil.Send(http.MethodPost, srv.URL+"/orders?b=2&a=1",
+		httputil.SendBody(strings.NewReader(`{"id":1}`)), httputil.SendSign("svc", []byte("s3cret")))
+	if assert.NoError(t, err) {
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		assert.Equal(t, `{"id":1}`, string(body))
+	}
+
+	// 重试时重新签名，nonce 不同且时间戳更新，两次请求都通过校验
+	lock.Lock()
+	nonces, timestamps = nil, nil
+	lock.Unlock()
+	resp, err = httputil.Send(http.MethodPost, srv.URL+"/orders?fail=1",
+		httputil.SendBody(strings.NewReader(`{"id":2}`)), httputil.SendSign("svc", []byte("s3cret")),
+		httputil.SendRetry(httputil.RetryBackoff(backoff.WithMaxRetries(backoff.NewConstantBackOff(time.Second), 1))))
+	if assert.NoError(t, err) {
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		assert.Equal(t, `{"id":2}`, string(body))
+	}
+	if assert.Len(t, nonces, 2) {
+		assert.NotEqual(t, nonces[0], nonces[1])
+		first, _ := strconv.ParseInt(timestamps[0], 10, 64)
+		second, _ := strconv.ParseInt(timestamps[1], 10, 64)
+		assert.Greater(t, second, first)
+	}
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/maxliu9403/common/gadget"
+	"github.com/opentracing/opentracing-go"
+)
+
+// Timeout 为请求设置截止时间，一般挂在路由组上以便不同的组使用不同的超时时间，例如
+//
+//	g := server.AddGinGroup("/api")
+//	g.Use(middleware.Timeout(5 * time.Second))
+//
+// 截止时间设置在 c.Request.Context() 上，并同步到 gadget.SpanCtxKey，
+// 因此 gormdb.Cli(c)、httputil.SendWithCtx(c, ...)、rediscache.NewCRUD(c, ...) 都会在超时后被取消。
+// handler 在当前 goroutine 中执行，超时后 handler 尚未写出的响应会被丢弃并返回 504，
+// 所以 handler 需要把 ctx 传递给下游调用，否则无法提前返回。
+func Timeout(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+
+		prev, _ := c.Get(gadget.SpanCtxKey)
+		spanCtx := ctx
+		if parent, err := gadget.ExtractTraceSpan(c); err == nil {
+			if span := opentracing.SpanFromContext(parent); span != nil {
+				spanCtx = opentracing.ContextWithSpan(ctx, span)
+			}
+		}
+		c.Set(gadget.SpanCtxKey, spanCtx)
+
+		defer c.Set(gadget.SpanCtxKey, prev)
+
+		tw := &timeoutWriter{ResponseWriter: c.Writer, ctx: ctx}
+		c.Writer = tw
+		// handler panic 时也要恢复，否则外层 Recovery 的响应会被 timeoutWriter 丢弃
+		defer func() { c.Writer = tw.ResponseWriter }()
+		c.Next()
+		c.Writer = tw.ResponseWriter
+
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) || (c.Writer.Written() && !tw.timedOut) {
+			return
+		}
+
+		requestTimeouts.WithLabelValues(c.Request.Method, c.FullPath()).Inc()
+		abortWithResponse(c, http.StatusGatewayTimeout, "request timeout")
+	}
+}
+
+// timeoutWriter 在截止时间之后丢弃 handler 的写入，只要 handler 在截止时间前已经开始写响应，就不再拦截
+type timeoutWriter struct {
+	gin.ResponseWriter
+	ctx      context.Context
+	timedOut bool
+}
+
+// expired 只有超时才丢弃写入，请求被取消时仍然正常写出
+func (w *timeoutWriter) expired() bool {
+	if !w.timedOut && !w.ResponseWriter.Written() && errors.Is(w.ctx.Err(), context.DeadlineExceeded) {
+		w.timedOut = true
+	}
+
+	return w.timedOut
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	if w.expired() {
+		return
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	if w.expired() {
+		return
+	}
+
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	// gin 的 render 在写入失败时会 panic，这里直接丢弃
+	if w.expired() {
+		return len(data), nil
+	}
+
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	if w.expired() {
+		return len(s), nil
+	}
+
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *timeoutWriter) Flush() {
+	if w.expired() {
+		return
+	}
+
+	w.ResponseWriter.Flush()
+}
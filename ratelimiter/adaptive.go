@@ -0,0 +1,305 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Priority 请求优先级，过载时低优先级的请求先被丢弃
+type Priority int
+
+const (
+	PriorityLow      Priority = iota // 达到 80% 的并发上限即被丢弃，不排队
+	PriorityNormal                   // 达到并发上限后排队
+	PriorityHigh                     // 达到并发上限后排在队首
+	PriorityCritical                 // 不受限制，用于健康检查等
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityHigh:
+		return "high"
+	case PriorityCritical:
+		return "critical"
+	default:
+		return "normal"
+	}
+}
+
+var ErrLimitExceeded = errors.New("concurrency limit exceeded")
+
+var (
+	limiterLimit = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "adaptive_limiter_limit",
+		Help: "Current concurrency limit of the adaptive limiter.",
+	}, []string{"name"})
+	limiterInflight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "adaptive_limiter_inflight",
+		Help: "Number of in-flight requests admitted by the adaptive limiter.",
+	}, []string{"name"})
+	limiterQueue = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "adaptive_limiter_queue_depth",
+		Help: "Number of requests waiting for the adaptive limiter.",
+	}, []string{"name"})
+	limiterShed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "adaptive_limiter_shed_total",
+		Help: "Total number of requests shed by the adaptive limiter.",
+	}, []string{"name", "priority"})
+
+	adaptiveLimiters sync.Map
+)
+
+func init() {
+	prometheus.MustRegister(limiterLimit, limiterInflight, limiterQueue, limiterShed)
+}
+
+type AdaptiveConfig struct {
+	Enable       bool    `yaml:"enable" env:"LoadShedding" env-description:"enable adaptive load shedding or not"`
+	InitialLimit int     `yaml:"initial_limit"`    // 初始并发上限
+	MinLimit     int     `yaml:"min_limit"`        // 最小并发上限
+	MaxLimit     int     `yaml:"max_limit"`        // 最大并发上限
+	MaxQueue     int     `yaml:"max_queue"`        // 达到上限后最多排队的请求数
+	QueueTimeout int     `yaml:"queue_timeout_ms"` // 排队的最长时间，单位毫秒
+	Tolerance    float64 `yaml:"tolerance"`        // 可以容忍的延迟相对空载延迟的倍数
+	Smoothing    float64 `yaml:"smoothing"`        // 并发上限的平滑系数
+	BackoffRatio float64 `yaml:"backoff_ratio"`    // 请求失败时并发上限的衰减比例
+}
+
+func (c *AdaptiveConfig) initConfig() *AdaptiveConfig {
+	if c.InitialLimit == 0 {
+		c.InitialLimit = 100
+	}
+	if c.MinLimit == 0 {
+		c.MinLimit = 10
+	}
+	if c.MaxLimit == 0 {
+		c.MaxLimit = 1000
+	}
+	if c.MaxQueue == 0 {
+		c.MaxQueue = c.MinLimit
+	}
+	if c.QueueTimeout == 0 {
+		c.QueueTimeout = 100
+	}
+	if c.Tolerance == 0 {
+		c.Tolerance = 2
+	}
+	if c.Smoothing == 0 {
+		c.Smoothing = 0.2
+	}
+	if c.BackoffRatio == 0 {
+		c.BackoffRatio = 0.9
+	}
+
+	return c
+}
+
+// AdaptiveLimiter 基于延迟梯度（Vegas/gradient 风格）自适应调整并发上限：
+// 并发接近上限且延迟接近空载延迟时逐步加大上限，延迟升高时按比例收缩，请求失败时乘性减小（AIMD）。
+type AdaptiveLimiter struct {
+	name string
+	conf AdaptiveConfig
+
+	lock     sync.Mutex
+	limit    float64
+	inflight int
+	waiters  []*waiter
+	minRTT   time.Duration
+	samples  int
+	shed     map[Priority]int64
+}
+
+type waiter struct {
+	ch      chan struct{}
+	granted bool
+}
+
+// Stats 限流器当前状态
+type Stats struct {
+	Name     string           `json:"name"`
+	Limit    int              `json:"limit"`
+	Inflight int              `json:"inflight"`
+	Queue    int              `json:"queue"`
+	MinRTT   string           `json:"min_rtt"`
+	Shed     map[string]int64 `json:"shed"`
+}
+
+// NewAdaptiveLimiter 创建限流器，name 用于监控指标，同名的限流器会被覆盖
+func NewAdaptiveLimiter(name string, c AdaptiveConfig) *AdaptiveLimiter {
+	c.initConfig()
+
+	l := &AdaptiveLimiter{
+		name:  name,
+		conf:  c,
+		limit: float64(c.InitialLimit),
+		shed:  make(map[Priority]int64),
+	}
+	limiterLimit.WithLabelValues(name).Set(l.limit)
+	adaptiveLimiters.Store(name, l)
+
+	return l
+}
+
+// AdaptiveLimiters 返回所有限流器的状态
+func AdaptiveLimiters() []Stats {
+	var res []Stats
+	adaptiveLimiters.Range(func(_, value interface{}) bool {
+		res = append(res, value.(*AdaptiveLimiter).Stats())
+		return true
+	})
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+
+	return res
+}
+
+// Acquire 获取执行许可，成功时返回的 release 必须在请求结束后调用，
+// latency 为请求耗时，dropped 表示请求因过载失败（超时、5xx 等）
+func (l *AdaptiveLimiter) Acquire(ctx context.Context, p Priority) (release func(latency time.Duration, dropped bool), err error) {
+	if p >= PriorityCritical {
+		return func(time.Duration, bool) {}, nil
+	}
+
+	l.lock.Lock()
+	limit := int(l.limit)
+	if p == PriorityLow {
+		limit = int(l.limit * 0.8)
+	}
+
+	if l.inflight < limit && len(l.waiters) == 0 {
+		l.inflight++
+		l.updateGauges()
+		l.lock.Unlock()
+		return l.release, nil
+	}
+
+	if p == PriorityLow || len(l.waiters) >= l.conf.MaxQueue {
+		l.rejectLocked(p)
+		l.lock.Unlock()
+		return nil, ErrLimitExceeded
+	}
+
+	w := &waiter{ch: make(chan struct{})}
+	if p == PriorityHigh {
+		l.waiters = append([]*waiter{w}, l.waiters...)
+	} else {
+		l.waiters = append(l.waiters, w)
+	}
+	l.updateGauges()
+	l.lock.Unlock()
+
+	timer := time.NewTimer(time.Duration(l.conf.QueueTimeout) * time.Millisecond)
+	defer timer.Stop()
+
+	select {
+	case <-w.ch:
+		return l.release, nil
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	// 超时的同时可能已经被唤醒
+	if w.granted {
+		return l.release, nil
+	}
+
+	for i := range l.waiters {
+		if l.waiters[i] == w {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			break
+		}
+	}
+	l.rejectLocked(p)
+
+	return nil, ErrLimitExceeded
+}
+
+func (l *AdaptiveLimiter) release(latency time.Duration, dropped bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	inflight := l.inflight
+	l.inflight--
+	l.updateLimit(latency, dropped, inflight)
+
+	for len(l.waiters) > 0 && l.inflight < int(l.limit) {
+		w := l.waiters[0]
+		l.waiters = l.waiters[1:]
+		w.granted = true
+		l.inflight++
+		close(w.ch)
+	}
+
+	l.updateGauges()
+}
+
+// limitBoundRatio 请求结束时并发数达到上限的这个比例才认为受上限约束，只有受约束时才加大上限，
+// 否则空闲时上限会无限增长，突发流量到来时无法及时限流
+const limitBoundRatio = 0.5
+
+// updateLimit inflight 为包括当前请求在内的并发数
+func (l *AdaptiveLimiter) updateLimit(latency time.Duration, dropped bool, inflight int) {
+	var newLimit float64
+	if dropped {
+		newLimit = l.limit * l.conf.BackoffRatio
+	} else {
+		// 空载延迟取近期最小值，定期重置以适应下游的变化
+		l.samples++
+		if l.minRTT == 0 || latency < l.minRTT || l.samples > 1000 {
+			l.minRTT = latency
+			l.samples = 0
+		}
+		if latency <= 0 {
+			return
+		}
+
+		gradient := math.Max(0.5, math.Min(1, l.conf.Tolerance*float64(l.minRTT)/float64(latency)))
+		newLimit = l.limit * gradient
+		if float64(inflight) >= l.limit*limitBoundRatio {
+			newLimit += math.Sqrt(l.limit)
+		}
+		newLimit = l.limit*(1-l.conf.Smoothing) + newLimit*l.conf.Smoothing
+	}
+
+	l.limit = math.Max(float64(l.conf.MinLimit), math.Min(float64(l.conf.MaxLimit), newLimit))
+}
+
+func (l *AdaptiveLimiter) rejectLocked(p Priority) {
+	l.shed[p]++
+	limiterShed.WithLabelValues(l.name, p.String()).Inc()
+}
+
+func (l *AdaptiveLimiter) updateGauges() {
+	limiterLimit.WithLabelValues(l.name).Set(l.limit)
+	limiterInflight.WithLabelValues(l.name).Set(float64(l.inflight))
+	limiterQueue.WithLabelValues(l.name).Set(float64(len(l.waiters)))
+}
+
+func (l *AdaptiveLimiter) Stats() Stats {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	s := Stats{
+		Name:     l.name,
+		Limit:    int(l.limit),
+		Inflight: l.inflight,
+		Queue:    len(l.waiters),
+		MinRTT:   l.minRTT.String(),
+		Shed:     make(map[string]int64),
+	}
+	for p, n := range l.shed {
+		s.Shed[p.String()] = n
+	}
+
+	return s
+}
@@ -0,0 +1,101 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptiveLimiterShed(t *testing.T) {
+	l := NewAdaptiveLimiter("test-shed", AdaptiveConfig{InitialLimit: 2, MinLimit: 2, MaxQueue: 1, QueueTimeout: 20})
+	ctx := context.Background()
+
+	r1, err := l.Acquire(ctx, PriorityNormal)
+	assert.NoError(t, err)
+	_, err = l.Acquire(ctx, PriorityNormal)
+	assert.NoError(t, err)
+
+	// 低优先级不排队，critical 不受限制
+	_, err = l.Acquire(ctx, PriorityLow)
+	assert.Equal(t, ErrLimitExceeded, err)
+	_, err = l.Acquire(ctx, PriorityCritical)
+	assert.NoError(t, err)
+
+	// 排队等待时被唤醒
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		r1(time.Millisecond, false)
+	}()
+	_, err = l.Acquire(ctx, PriorityNormal)
+	assert.NoError(t, err)
+
+	// 排队超时
+	_, err = l.Acquire(ctx, PriorityNormal)
+	assert.Equal(t, ErrLimitExceeded, err)
+
+	s := l.Stats()
+	assert.Equal(t, 2, s.Inflight)
+	assert.Equal(t, int64(1), s.Shed["low"])
+	assert.Equal(t, int64(1), s.Shed["normal"])
+}
+
+func TestAdaptiveLimiterAdjust(t *testing.T) {
+	l := NewAdaptiveLimiter("test-adjust", AdaptiveConfig{InitialLimit: 50, MinLimit: 10, MaxLimit: 100})
+	ctx := context.Background()
+
+	// 并发达到上限时加大上限
+	releases := make([]func(time.Duration, bool), 0, 50)
+	for i := 0; i < 50; i++ {
+		release, err := l.Acquire(ctx, PriorityNormal)
+		assert.NoError(t, err)
+		releases = append(releases, release)
+	}
+	for _, release := range releases {
+		release(10*time.Millisecond, false)
+	}
+	grown := l.Stats().Limit
+	assert.Greater(t, grown, 50)
+
+	release, _ := l.Acquire(ctx, PriorityNormal)
+	release(10*time.Millisecond, true)
+	assert.Less(t, l.Stats().Limit, grown)
+
+	// 延迟远高于空载延迟时收缩到最小值
+	for i := 0; i < 50; i++ {
+		release, err := l.Acquire(ctx, PriorityNormal)
+		assert.NoError(t, err)
+		release(100*time.Millisecond, false)
+	}
+	assert.Equal(t, 10, l.Stats().Limit)
+}
+
+func TestAdaptiveLimiterBound(t *testing.T) {
+	l := NewAdaptiveLimiter("test-bound", AdaptiveConfig{InitialLimit: 20, MinLimit: 10, MaxLimit: 40})
+	ctx := context.Background()
+
+	// 空闲时并发远低于上限，上限不增长
+	for i := 0; i < 1000; i++ {
+		release, err := l.Acquire(ctx, PriorityNormal)
+		assert.NoError(t, err)
+		release(10*time.Millisecond, false)
+	}
+	assert.Equal(t, 20, l.Stats().Limit)
+
+	// 持续打满时增长到 MaxLimit 为止
+	for round := 0; round < 100; round++ {
+		var releases []func(time.Duration, bool)
+		for {
+			release, err := l.Acquire(ctx, PriorityLow)
+			if err != nil {
+				break
+			}
+			releases = append(releases, release)
+		}
+		for _, release := range releases {
+			release(10*time.Millisecond, false)
+		}
+	}
+	assert.Equal(t, 40, l.Stats().Limit)
+}
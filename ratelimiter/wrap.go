@@ -0,0 +1,28 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Wrap(router *gin.Engine) {
+	WrapGroup(&router.RouterGroup)
+}
+
+// WrapGroup 注册查看自适应限流器状态的接口，一般挂在 admin 服务上
+func WrapGroup(router *gin.RouterGroup) {
+	path := "/debug/limiter"
+	if strings.HasSuffix(strings.TrimSuffix(router.BasePath(), "/"), "/debug") {
+		path = strings.TrimPrefix(path, "/debug")
+	}
+
+	router.GET(path, StatsHandler())
+}
+
+func StatsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, AdaptiveLimiters())
+	}
+}
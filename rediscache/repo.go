@@ -9,6 +9,7 @@ package rediscache
 import (
 	"context"
 	"fmt"
+	"github.com/maxliu9403/common/gadget"
 	"github.com/maxliu9403/common/logger"
 	"time"
 
@@ -22,6 +23,11 @@ type RedisCrud struct {
 }
 
 func NewCRUD(ctx context.Context, cli *redis.Client) BasicCrud {
+	// 传入 gin.Context 时使用其中携带的 span ctx，以便继承请求的截止时间
+	if spanCtx, err := gadget.ExtractTraceSpan(ctx); err == nil {
+		ctx = spanCtx
+	}
+
 	return &RedisCrud{Ctx: ctx, Rdb: cli}
 }
 